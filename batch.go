@@ -0,0 +1,50 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import "fmt"
+
+// CodeBatch is like calling Code on each of stripes[], e.g. for many
+// small stripes of the same geometry as in page parity, but with less
+// overhead per stripe: all the outputs are carved out of a single
+// allocation, and the coder's multiplication tables are shared by all
+// of them.  Every stripe is checked before any is coded; if one is
+// malformed, CodeBatch panics like Code, with its index in the
+// message.  The outputs of different stripes may differ in size.
+func (p *ErasureCoder) CodeBatch(stripes [][][]uint8) (out [][][]uint8) {
+	total := 0
+	for s, in := range stripes {
+		if err := p.inputError(in); err != nil {
+			fail(fmt.Errorf("Stripe %d: %v", s, err))
+			return nil
+		}
+		total += blockSize(in)
+	}
+
+	m := p.NumOutputs()
+	buf := make([]uint8, total*m)
+	rows := make([][]uint8, len(stripes)*m)
+	out = make([][][]uint8, len(stripes))
+	for s, in := range stripes {
+		n := blockSize(in)
+		out[s] = rows[s*m : (s+1)*m : (s+1)*m]
+		for k := range out[s] {
+			out[s][k] = buf[:n:n]
+			buf = buf[n:]
+		}
+		p.code(in, out[s])
+	}
+	return
+}
@@ -0,0 +1,99 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCodeBatch(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	stripes := [][][]byte{
+		randomMatrix(3, 64, 1),
+		randomMatrix(3, 10, 2),
+		{nil, nil, nil},
+		randomMatrix(3, 64, 3),
+	}
+	stripes[3][1] = nil
+	out := c.CodeBatch(stripes)
+	if len(out) != len(stripes) {
+		t.Fatal("stripes: ", len(out))
+	}
+	for s, in := range stripes {
+		want := c.Code(in)
+		for k := range want {
+			if !bytes.Equal(out[s][k], want[k]) {
+				t.Errorf("stripe %d: output %d differs from Code", s, k)
+			}
+		}
+	}
+
+	// The outputs don't overlap: appending to one clobbers no other.
+	out[0][0] = append(out[0][0], 1)
+	out[0] = append(out[0], nil)
+	if want := c.Code(stripes[0]); !bytes.Equal(out[0][1], want[1]) {
+		t.Error("output 1 of stripe 0 aliased by output 0")
+	}
+	if want := c.Code(stripes[1]); !bytes.Equal(out[1][0], want[0]) {
+		t.Error("stripe 1 aliased by stripe 0")
+	}
+
+	if out := c.CodeBatch(nil); len(out) != 0 {
+		t.Error("CodeBatch(nil) = ", out)
+	}
+}
+
+func TestCodeBatchPanicOnBadStripe(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("Failed to panic")
+		}
+		if !strings.HasPrefix(fmt.Sprint(r), "Stripe 1: Ragged input matrix") {
+			t.Error("panic does not name the stripe: ", r)
+		}
+	}()
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	bad := randomMatrix(3, 10, 2)
+	bad[2] = bad[2][:9]
+	c.CodeBatch([][][]byte{randomMatrix(3, 10, 1), bad}) // should panic
+}
+
+// Many stripes of one 4k page per input.
+func BenchmarkCodeBatch(b *testing.B) {
+	const stripes, n = 64, 4 << 10
+	c := NewErasureCoder([]byte{0, 1, 2, 3, 4, 5, 6, 7}, []byte{8, 9})
+	in := make([][][]byte, stripes)
+	for s := range in {
+		in[s] = randomMatrix(8, n, byte(s))
+	}
+	b.Run("Code", func(b *testing.B) {
+		b.SetBytes(stripes * 8 * n)
+		for i := 0; i < b.N; i++ {
+			for _, s := range in {
+				c.Code(s)
+			}
+		}
+	})
+	b.Run("CodeBatch", func(b *testing.B) {
+		b.SetBytes(stripes * 8 * n)
+		for i := 0; i < b.N; i++ {
+			c.CodeBatch(in)
+		}
+	})
+}
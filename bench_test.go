@@ -0,0 +1,70 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"fmt"
+	"testing"
+)
+
+// The reference workloads for performance work on the coder.
+
+var benchShapes = []struct{ degree, outputs int }{{4, 6}, {10, 14}}
+
+var benchBlockSizes = []int{4 << 10, 128 << 10, 1 << 20}
+
+func BenchmarkCode(b *testing.B) {
+	for _, s := range benchShapes {
+		c := NewErasureCoder(iota8(s.degree), iota8(s.degree + s.outputs)[s.degree:])
+		for _, n := range benchBlockSizes {
+			in := randomMatrix(s.degree, n, 1)
+			out := makeMatrix(s.outputs, n)
+			b.Run(fmt.Sprintf("%dx%d/%dK", s.degree, s.outputs, n>>10), func(b *testing.B) {
+				b.SetBytes(int64(s.degree * n))
+				for i := 0; i < b.N; i++ {
+					c.CodeInto(in, out)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkUpdate(b *testing.B) {
+	for _, s := range benchShapes {
+		c := NewErasureCoder(iota8(s.degree), iota8(s.degree + s.outputs)[s.degree:])
+		for _, n := range benchBlockSizes {
+			delta := randomMatrix(1, n, 1)[0]
+			out := makeMatrix(s.outputs, n)
+			b.Run(fmt.Sprintf("%dx%d/%dK", s.degree, s.outputs, n>>10), func(b *testing.B) {
+				b.SetBytes(int64(n))
+				for i := 0; i < b.N; i++ {
+					c.Update(uint8(i%s.degree), delta, out)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkNewErasureCoder(b *testing.B) {
+	for _, s := range []struct{ degree, outputs int }{{10, 14}, {64, 64}, {128, 128}} {
+		in_x := iota8(s.degree)
+		out_x := iota8(s.degree + s.outputs)[s.degree:]
+		b.Run(fmt.Sprintf("%dx%d", s.degree, s.outputs), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				NewErasureCoder(in_x, out_x)
+			}
+		})
+	}
+}
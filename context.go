@@ -0,0 +1,58 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import "context"
+
+// contextChunk is the number of columns CodeContext computes between
+// checks of its context.  Large enough that the check is lost in the
+// noise, small enough that cancellation takes effect within a
+// millisecond or so even at high degree.
+const contextChunk = 64 << 10
+
+// CodeContext is like CodeErr, but computes the outputs in batches of
+// columns and checks ctx between batches, returning ctx.Err() and no
+// outputs as soon as it is canceled.
+func (p *ErasureCoder) CodeContext(ctx context.Context, in [][]uint8) (out [][]uint8, err error) {
+	if err := p.inputError(in); err != nil {
+		return nil, err
+	}
+	n := blockSize(in)
+	out = makeMatrix(len(p.interp[0]), n)
+	sub_in := make([][]uint8, len(in))
+	sub_out := make([][]uint8, len(out))
+	for lo := 0; lo < n; lo += contextChunk {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		hi := lo + contextChunk
+		if hi > n {
+			hi = n
+		}
+		for i := range in {
+			if in[i] != nil {
+				sub_in[i] = in[i][lo:hi]
+			}
+		}
+		for k := range out {
+			sub_out[k] = out[k][lo:hi]
+		}
+		p.code(sub_in, sub_out)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
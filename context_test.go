@@ -0,0 +1,66 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+// A context that is canceled after its Err has been called n times.
+type countdownContext struct {
+	context.Context
+	n int
+}
+
+func (c *countdownContext) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestCodeContext(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2, 3}, []byte{4, 5})
+	in := randomMatrix(4, 3*contextChunk+17, 6)
+	in[2] = nil
+	out, err := c.CodeContext(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := c.Code(in)
+	for k := range want {
+		if !bytes.Equal(out[k], want[k]) {
+			t.Errorf("output %d differs", k)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if out, err := c.CodeContext(ctx, in); err != context.Canceled || out != nil {
+		t.Error("canceled: ", len(out), err)
+	}
+
+	// Canceled while the last chunk is computed.
+	ctx = &countdownContext{context.Background(), 4}
+	if out, err := c.CodeContext(ctx, in); err != context.Canceled || out != nil {
+		t.Error("canceled in the last chunk: ", len(out), err)
+	}
+
+	if _, err := c.CodeContext(context.Background(), in[:3]); err == nil {
+		t.Error("no error for too few inputs")
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import "fmt"
+
+// Error correction, as opposed to erasure decoding: a codeword of n
+// symbols, the values at the abscissae 0...n-1 of a polynomial through
+// k data symbols at 0...k-1, as computed by NewVandermondeCoder(k,
+// n-k), can have up to (n-k)/2 of its symbols wrong at unknown
+// positions, and still be corrected.
+//
+// The codewords c[] satisfy the n-k parity checks
+//
+//	sum_j v_j (x_j + b)^l c_j = 0,  l = 0...n-k-1,
+//
+// with the column multipliers v_j = 1 / prod_{i != j} (x_j - x_i):
+// for any polynomial g of degree less than n-1, sum_j v_j g(x_j) is the
+// coefficient of x^(n-1) of the polynomial through the g(x_j), i.e. 0,
+// and the products (x + b)^l P(x) are such polynomials.  The shift b,
+// an abscissa that is not in the code, keeps the error locators
+// X_j = x_j + b from being 0.  For a received word r = c + e, the
+// syndromes S_l = sum_j v_j (x_j + b)^l r_j are then sum_j Y_j X_j^l
+// over the positions in error, with Y_j = v_j e_j, the form the
+// classical decoders expect.  Berlekamp-Massey finds the error locator
+// polynomial prod_j (1 - X_j z) from the S_l, a Chien search its roots
+// among the X_j^-1, and Forney's formula the Y_j.
+
+// DecodeErrors corrects up to (len(received)-k)/2 wrong symbols in the
+// codeword received[] of k data symbols, and returns the data, i.e.
+// the first k symbols of the corrected codeword.  It returns an error
+// if there are more errors than that, as far as it can tell: a word
+// with many errors may also be closer to, and corrected to, another
+// codeword.  len(received) may be at most 255, one abscissa being
+// needed for the shift.
+func DecodeErrors(received []uint8, k int) ([]uint8, error) {
+	n := len(received)
+	if k < 1 || k > n || n > 255 {
+		return nil, fmt.Errorf("Invalid codeword of %d symbols for %d data symbols", n, k)
+	}
+	shift := uint8(n)
+
+	// v_j and X_j.
+	v := make([]uint8, n)
+	locator := make([]uint8, n)
+	for j := range v {
+		var p uint8 = 1
+		for i := 0; i < n; i++ {
+			if i != j {
+				p = mult(p, uint8(j^i))
+			}
+		}
+		v[j] = inv[p]
+		locator[j] = uint8(j) ^ shift
+	}
+
+	syndromes := func(r []uint8) ([]uint8, bool) {
+		s := make([]uint8, n-k)
+		zero := true
+		for j, rj := range r {
+			y := mult(v[j], rj)
+			for l := range s {
+				s[l] ^= y
+				y = mult(y, locator[j])
+			}
+		}
+		for _, sl := range s {
+			zero = zero && sl == 0
+		}
+		return s, zero
+	}
+	s, zero := syndromes(received)
+	if zero {
+		return append([]uint8(nil), received[:k]...), nil
+	}
+
+	lambda := berlekampMassey(s)
+	nerr := len(lambda) - 1
+	if 2*nerr > n-k {
+		return nil, fmt.Errorf("Too many errors in codeword: more than %d", (n-k)/2)
+	}
+
+	// Omega(z) = S(z) Lambda(z) mod z^(n-k)
+	omega := make([]uint8, n-k)
+	for i, li := range lambda {
+		for l := 0; i+l < len(omega); l++ {
+			omega[i+l] ^= mult(li, s[l])
+		}
+	}
+
+	corrected := append([]uint8(nil), received...)
+	found := 0
+	for j := range corrected {
+		zinv := inv[locator[j]]
+		if polyEval(lambda, zinv) != 0 {
+			continue
+		}
+		found++
+		// Lambda'(z) has the odd coefficients of Lambda.
+		var d, zi, zz uint8 = 0, 1, mult(zinv, zinv)
+		for i := 1; i < len(lambda); i += 2 {
+			d ^= mult(lambda[i], zi)
+			zi = mult(zi, zz)
+		}
+		if d == 0 {
+			return nil, fmt.Errorf("Too many errors in codeword: repeated root of the error locator")
+		}
+		y := div(mult(locator[j], polyEval(omega, zinv)), d)
+		corrected[j] ^= div(y, v[j])
+	}
+	if found != nerr {
+		return nil, fmt.Errorf("Too many errors in codeword: found %d of %d error locations", found, nerr)
+	}
+	if _, zero := syndromes(corrected); !zero {
+		return nil, fmt.Errorf("Too many errors in codeword: correction failed")
+	}
+	return corrected[:k:k], nil
+}
+
+// Return the shortest polynomial Lambda, lowest coefficient first,
+// with Lambda[0] = 1 that generates s[] as a linear recurrence, by the
+// Berlekamp-Massey algorithm.
+func berlekampMassey(s []uint8) []uint8 {
+	c := make([]uint8, len(s)+1) // the current connection polynomial
+	b := make([]uint8, len(s)+1) // the one before the last length change
+	c[0], b[0] = 1, 1
+	l, m, bd := 0, 1, uint8(1)
+	t := make([]uint8, len(c))
+	for n := range s {
+		d := s[n]
+		for i := 1; i <= l; i++ {
+			d ^= mult(c[i], s[n-i])
+		}
+		if d == 0 {
+			m++
+			continue
+		}
+		f := div(d, bd)
+		copy(t, c)
+		for i := 0; i+m < len(c); i++ {
+			c[i+m] ^= mult(f, b[i])
+		}
+		if 2*l <= n {
+			l = n + 1 - l
+			copy(b, t)
+			bd = d
+			m = 1
+		} else {
+			m++
+		}
+	}
+	return c[:l+1]
+}
+
+// Evaluate the polynomial p, lowest coefficient first, at x.
+func polyEval(p []uint8, x uint8) (y uint8) {
+	for i := len(p) - 1; i >= 0; i-- {
+		y = mult(y, x) ^ p[i]
+	}
+	return
+}
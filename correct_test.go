@@ -0,0 +1,95 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// Return a codeword of the systematic coder c for random data symbols.
+func codeword(rnd *rand.Rand, c *ErasureCoder) (data, word []byte) {
+	data = make([]byte, c.Degree())
+	rnd.Read(data)
+	in := make([][]byte, len(data))
+	for i, d := range data {
+		in[i] = []byte{d}
+	}
+	for _, o := range c.Code(in) {
+		word = append(word, o[0])
+	}
+	return
+}
+
+// Return word with e symbols, at distinct random positions, changed.
+func corrupt(rnd *rand.Rand, word []byte, e int) []byte {
+	r := append([]byte(nil), word...)
+	for _, j := range rnd.Perm(len(r))[:e] {
+		r[j] ^= byte(1 + rnd.Intn(255))
+	}
+	return r
+}
+
+func TestDecodeErrors(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, c := range []struct{ k, n int }{{1, 3}, {4, 6}, {3, 10}, {10, 14}, {200, 255}, {5, 6}} {
+		coder := NewVandermondeCoder(c.k, c.n-c.k)
+		for e := 0; 2*e <= c.n-c.k; e++ {
+			for trial := 0; trial < 20; trial++ {
+				data, word := codeword(rnd, coder)
+				got, err := DecodeErrors(corrupt(rnd, word, e), c.k)
+				if err != nil || !bytes.Equal(got, data) {
+					t.Fatalf("k=%d, n=%d, %d errors: %v, %v != %v", c.k, c.n, e, err, got, data)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeErrorsAtEnds(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	data, word := codeword(rnd, NewVandermondeCoder(4, 4))
+	word[0] ^= 0x55
+	word[7] ^= 0xAA
+	if got, err := DecodeErrors(word, 4); err != nil || !bytes.Equal(got, data) {
+		t.Error("errors at abscissae 0 and 7: ", got, err)
+	}
+}
+
+func TestDecodeErrorsTooMany(t *testing.T) {
+	// A word with more than (n-k)/2 errors is further from the original
+	// than that, so it can't be corrected to it: DecodeErrors must
+	// either fail, or find another codeword.
+	rnd := rand.New(rand.NewSource(3))
+	failed := 0
+	coder := NewVandermondeCoder(4, 6)
+	for trial := 0; trial < 200; trial++ {
+		data, word := codeword(rnd, coder)
+		got, err := DecodeErrors(corrupt(rnd, word, 4), 4)
+		if err != nil {
+			failed++
+		} else if bytes.Equal(got, data) {
+			t.Fatal("corrected 4 errors with 6 parity symbols")
+		}
+	}
+	if failed < 150 {
+		t.Error("only ", failed, " of 200 uncorrectable words detected")
+	}
+
+	if _, err := DecodeErrors(make([]byte, 256), 4); err == nil {
+		t.Error("DecodeErrors accepted 256 symbols")
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+// UpdateCRC is like Update, but the delta applies to the bytes
+// out[k][off:off+len(in_delta)] of whole output shards, and crcs[k],
+// the CRC-32C of out[k] as set by CodeFixedCRC, is kept current
+// without rehashing the shard.
+//
+// The CRC is affine in its input: crc(a^d) == crc(a) ^ crc(d) ^
+// crc(zeros) for blocks of equal length.  The change to crcs[k] is
+// therefore the zero-initialized CRC of the change to out[k], and the
+// zeros in front of the changed range don't contribute to it, while
+// those behind it amount to a linear map on the CRC state that can be
+// applied in O(log n) steps.  The cost per output is thus proportional
+// to len(in_delta), not to the shard size.
+func (p *ErasureCoder) UpdateCRC(idx uint8, off int, in_delta []uint8, out [][]uint8, crcs []uint32) {
+	if int(idx) >= len(p.interp) {
+		fail(fmt.Errorf("Abscissa index out of range %d for polynomial of degree %d", idx, len(p.interp)))
+		return
+	}
+	if len(out) != len(p.interp[0]) || len(crcs) != len(out) {
+		fail(fmt.Errorf("Wrong number of outputs or checksums: %d, %d != %d", len(out), len(crcs), len(p.interp[0])))
+		return
+	}
+	for k := range out {
+		if off < 0 || off+len(in_delta) > len(out[k]) {
+			fail(fmt.Errorf("Delta [%d:%d] out of range for out[%d] of length %d", off, off+len(in_delta), k, len(out[k])))
+			return
+		}
+	}
+
+	delta := make([]uint8, len(in_delta))
+	for k := range out {
+		if p.interp[idx][k] == 0 {
+			continue
+		}
+		for j := range delta {
+			delta[j] = 0
+		}
+		p.mulAdd(delta, in_delta, int(idx), k)
+		addSlice(out[k][off:], delta)
+		raw := ^crc32.Update(^uint32(0), castagnoli, delta)
+		crcs[k] ^= crcShift(raw, int64(len(out[k])-off-len(delta)), crc32.Castagnoli)
+	}
+}
+
+// crcShift returns the zero-initialized CRC state crc advanced over n
+// zero bytes, for the reflected polynomial poly.  This is the
+// matrix-squaring method of zlib's crc32_combine: the state transition
+// for a single zero bit is a 32x32 matrix over GF(2), and it is
+// squared up to the transition for 1, 2, 4, ... zero bytes.
+func crcShift(crc uint32, n int64, poly uint32) uint32 {
+	if n <= 0 {
+		return crc
+	}
+	var even, odd [32]uint32
+	odd[0] = poly
+	for i, row := 1, uint32(1); i < 32; i, row = i+1, row<<1 {
+		odd[i] = row
+	}
+	gf2Square(&even, &odd) // 2 zero bits
+	gf2Square(&odd, &even) // 4 zero bits
+	for {
+		gf2Square(&even, &odd)
+		if n&1 != 0 {
+			crc = gf2Times(&even, crc)
+		}
+		if n >>= 1; n == 0 {
+			break
+		}
+		gf2Square(&odd, &even)
+		if n&1 != 0 {
+			crc = gf2Times(&odd, crc)
+		}
+		if n >>= 1; n == 0 {
+			break
+		}
+	}
+	return crc
+}
+
+func gf2Times(mat *[32]uint32, vec uint32) (sum uint32) {
+	for i := 0; vec != 0; i, vec = i+1, vec>>1 {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+	}
+	return
+}
+
+func gf2Square(square, mat *[32]uint32) {
+	for i := range square {
+		square[i] = gf2Times(mat, mat[i])
+	}
+}
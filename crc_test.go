@@ -0,0 +1,65 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"hash/crc32"
+	"testing"
+)
+
+func TestCRCShift(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 7, 64, 1000, 4097} {
+		d := randomMatrix(1, 10, byte(n))[0]
+		z := append(append([]byte{}, d...), make([]byte, n)...)
+		want := ^crc32.Update(^uint32(0), castagnoli, z)
+		got := crcShift(^crc32.Update(^uint32(0), castagnoli, d), int64(n), crc32.Castagnoli)
+		if got != want {
+			t.Errorf("n=%d: %08x, want %08x", n, got, want)
+		}
+	}
+}
+
+func TestUpdateCRC(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2, 3}, []byte{4, 5, 6})
+	in := randomMatrix(4, 1000, 3)
+	out := makeMatrix(3, 1000)
+	crcs := make([]uint32, 3)
+	c.CodeFixedCRC(in, out, crcs)
+
+	for _, r := range []struct{ idx, off, n int }{{0, 0, 1000}, {1, 0, 10}, {2, 990, 10}, {3, 123, 456}, {1, 500, 0}} {
+		delta := randomMatrix(1, r.n, byte(r.off))[0]
+		c.UpdateCRC(uint8(r.idx), r.off, delta, out, crcs)
+		addSlice(in[r.idx][r.off:], delta)
+
+		want := c.Code(in)
+		for k := range want {
+			if !bytes.Equal(out[k], want[k]) {
+				t.Errorf("%v: output %d wrong", r, k)
+			}
+			if crc := crc32.Checksum(want[k], castagnoli); crcs[k] != crc {
+				t.Errorf("%v: crc %d is %08x, want %08x", r, k, crcs[k], crc)
+			}
+		}
+	}
+}
+
+func TestUpdateCRCPanicOnRange(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1}, []byte{2})
+	out := makeMatrix(1, 10)
+	defer recoverExpected(t)
+	c.UpdateCRC(0, 5, make([]byte, 6), out, make([]uint32, 1)) // should panic
+	t.Error("Failed to panic")
+}
@@ -0,0 +1,144 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import "fmt"
+
+// An Encoder offers the interface common to Reed-Solomon libraries:
+// the data and parity shards of a stripe are one slice of shards, the
+// first DataShards() of them data and the rest parity, and the
+// abscissae are managed internally, as by ChooseAbscissae.  It is built
+// on an ErasureCoder for the parity and a ReconstructCache for the
+// lost shards, and is safe for concurrent use.
+type Encoder struct {
+	data, parity int
+	coder        *ErasureCoder
+	rec          *ReconstructCache
+}
+
+// New returns an Encoder for stripes of data data and parity parity
+// shards.
+func New(data, parity int) (*Encoder, error) {
+	if err := systematicError(data, parity); err != nil {
+		return nil, err
+	}
+	if parity < 1 {
+		return nil, fmt.Errorf("Invalid code with %d data and %d parity shards", data, parity)
+	}
+	in_x, out_x := ChooseAbscissae(data, parity)
+	rec, err := NewReconstructCache(data, iota8(data+parity), 64)
+	if err != nil {
+		return nil, err
+	}
+	return &Encoder{data: data, parity: parity, coder: NewErasureCoder(in_x, out_x), rec: rec}, nil
+}
+
+// DataShards returns the number of data shards per stripe.
+func (e *Encoder) DataShards() int { return e.data }
+
+// ParityShards returns the number of parity shards per stripe.
+func (e *Encoder) ParityShards() int { return e.parity }
+
+// Check that there are as many shards as the code has.
+func (e *Encoder) countError(shards [][]uint8) error {
+	if len(shards) != e.data+e.parity {
+		return fmt.Errorf("Wrong number of shards: %d for %d data and %d parity shards", len(shards), e.data, e.parity)
+	}
+	return nil
+}
+
+// Return the size of the shards that are present, i.e. not empty, or
+// an error if they are not all of the same size, or if one of the
+// first required is missing.
+func presentSize(shards [][]uint8, required int) (int, error) {
+	n := 0
+	for i, s := range shards {
+		switch {
+		case len(s) == 0 && i < required:
+			return 0, fmt.Errorf("Shard %d is missing", i)
+		case len(s) == 0:
+		case n == 0:
+			n = len(s)
+		case len(s) != n:
+			return 0, fmt.Errorf("Shards of unequal size: shard %d has %d bytes, not %d", i, len(s), n)
+		}
+	}
+	return n, nil
+}
+
+// Encode computes the parity shards from the data shards, which must
+// all be present and of equal size.  Parity shards of that size are
+// overwritten, others are replaced with newly allocated ones.
+func (e *Encoder) Encode(shards [][]uint8) error {
+	if err := e.countError(shards); err != nil {
+		return err
+	}
+	n, err := presentSize(shards[:e.data], e.data)
+	if err != nil {
+		return err
+	}
+	for k := e.data; k < len(shards); k++ {
+		if len(shards[k]) != n {
+			shards[k] = make([]uint8, n)
+		}
+	}
+	e.coder.CodeInto(shards[:e.data], shards[e.data:])
+	return nil
+}
+
+// Reconstruct recomputes the missing shards, those that are nil or
+// empty, in place from the present ones.  At least DataShards() must
+// be present, and all of equal size.
+func (e *Encoder) Reconstruct(shards [][]uint8) error {
+	if err := e.countError(shards); err != nil {
+		return err
+	}
+	if _, err := presentSize(shards, 0); err != nil {
+		return err
+	}
+	var present_x, missing_x []uint8
+	var present [][]uint8
+	for i, s := range shards {
+		if len(s) == 0 {
+			missing_x = append(missing_x, uint8(i))
+		} else {
+			present_x = append(present_x, uint8(i))
+			present = append(present, s)
+		}
+	}
+	if len(missing_x) == 0 {
+		return nil
+	}
+	rec, err := e.rec.Reconstruct(present_x, present, missing_x)
+	if err != nil {
+		return err
+	}
+	for j, x := range missing_x {
+		shards[x] = rec[j]
+	}
+	return nil
+}
+
+// Verify reports whether the parity shards are those that Encode would
+// compute from the data shards.  All shards must be present.
+func (e *Encoder) Verify(shards [][]uint8) (bool, error) {
+	if err := e.countError(shards); err != nil {
+		return false, err
+	}
+	if _, err := presentSize(shards, len(shards)); err != nil {
+		return false, err
+	}
+	return e.coder.QuickCheck(shards), nil
+}
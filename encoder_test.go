@@ -0,0 +1,81 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	e, err := New(4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.DataShards() != 4 || e.ParityShards() != 2 {
+		t.Fatal("DataShards, ParityShards: ", e.DataShards(), e.ParityShards())
+	}
+	data := randomMatrix(4, 100, 1)
+	shards := append(append([][]byte{}, data...), nil, make([]byte, 3))
+	if err := e.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+	want := NewErasureCoder([]byte{0, 1, 2, 3}, []byte{4, 5}).Code(data)
+	for k := range want {
+		if !bytes.Equal(shards[4+k], want[k]) {
+			t.Errorf("parity %d differs", k)
+		}
+	}
+	if ok, err := e.Verify(shards); !ok || err != nil {
+		t.Error("Verify: ", ok, err)
+	}
+
+	// Lose a data and a parity shard.
+	lost := [][]byte{shards[1], shards[5]}
+	shards[1], shards[5] = nil, []byte{}
+	if ok, err := e.Verify(shards); ok || err == nil {
+		t.Error("Verify with missing shards: ", ok, err)
+	}
+	if err := e.Reconstruct(shards); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(shards[1], lost[0]) || !bytes.Equal(shards[5], lost[1]) {
+		t.Error("lost shards not reconstructed")
+	}
+
+	shards[0][7] ^= 1
+	if ok, err := e.Verify(shards); ok || err != nil {
+		t.Error("Verify of a corrupt stripe: ", ok, err)
+	}
+
+	shards[0], shards[2], shards[3] = nil, nil, nil
+	if err := e.Reconstruct(shards); err == nil {
+		t.Error("Reconstruct from too few shards")
+	}
+	if err := e.Encode(shards[:5]); err == nil {
+		t.Error("Encode of too few shards")
+	}
+	if err := e.Encode([][]byte{{1}, {2}, {3}, {4, 5}, nil, nil}); err == nil {
+		t.Error("Encode of ragged shards")
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for _, c := range [][2]int{{0, 2}, {4, 0}, {200, 57}, {-1, 3}} {
+		if _, err := New(c[0], c[1]); err == nil {
+			t.Error("New", c)
+		}
+	}
+}
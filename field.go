@@ -0,0 +1,132 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A Field is GF(2^8) constructed with a particular characteristic
+// polynomial.  The package functions and NewErasureCoder use the
+// default field, with polynomial x^8 + x^4 + x^3 + x^2 + 1 (0x11D).
+// Other polynomials are needed to interoperate with Reed-Solomon
+// implementations that use them.
+type Field struct {
+	poly uint16 // characteristic polynomial
+	exp  [255]uint8
+	log  [256]uint8
+	inv  [256]uint8
+
+	prodOnce sync.Once
+	prod     *[256][256]uint8 // prod[a][b] = a * b, see ProductTable
+}
+
+// The default field.  Its tables are also the exp[], log[] and inv[]
+// behind mult, div and the package functions, so there is one copy.
+var defaultField = func() *Field {
+	f, err := NewField(cp_84320)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}()
+
+// DefaultField returns the field the package uses by default.
+func DefaultField() *Field {
+	return defaultField
+}
+
+// NewField constructs GF(2^8) with characteristic polynomial poly,
+// given with its x^8 bit set, e.g. 0x11D or 0x12D.  The polynomial must
+// be primitive: x (2) must generate the whole multiplicative group, as
+// the exponent and logarithm tables are to the base x.  NewField
+// returns an error if poly is not of degree 8 or is not primitive,
+// e.g. 0x11B, which is irreducible but in which x has order 51.
+func NewField(poly uint16) (*Field, error) {
+	if poly < 0x100 || poly > 0x1ff {
+		return nil, fmt.Errorf("Characteristic polynomial %#x is not of degree 8", poly)
+	}
+
+	f := &Field{poly: poly}
+	var seen [256]bool
+	var a uint8 = 1
+	for i := range f.exp {
+		if a == 0 || seen[a] {
+			return nil, fmt.Errorf("Characteristic polynomial %#x is not primitive", poly)
+		}
+		seen[a] = true
+		f.exp[i] = a
+		f.log[a] = uint8(i)
+		a = poly_multiply(a, 2, poly)
+	}
+
+	for i := 1; i < 256; i++ {
+		f.inv[i] = f.exp[(255-int(f.log[i]))%255]
+	}
+	return f, nil
+}
+
+// Polynomial returns the characteristic polynomial of the field.
+func (f *Field) Polynomial() uint16 {
+	return f.poly
+}
+
+// Mul returns a * b in the field.
+func (f *Field) Mul(a, b uint8) uint8 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	idx := int(f.log[a]) + int(f.log[b])
+	if idx >= 255 {
+		idx -= 255
+	}
+	return f.exp[idx]
+}
+
+// Inv returns the multiplicative inverse of a in the field.  It panics
+// if a is 0, or returns 0, see SetStrictErrors.
+func (f *Field) Inv(a uint8) uint8 {
+	if a == 0 {
+		fail(fmt.Errorf("Inverse of 0"))
+		return 0
+	}
+	return f.inv[a]
+}
+
+// Div returns a / b in the field.  It panics if b is 0, or returns 0,
+// see SetStrictErrors.
+func (f *Field) Div(a, b uint8) uint8 {
+	return f.Mul(a, f.Inv(b))
+}
+
+// Fill tbl[] with the products of all field elements with c.
+func (f *Field) mulTable(c uint8, tbl *[256]uint8) {
+	for b := range tbl {
+		tbl[b] = f.Mul(uint8(b), c)
+	}
+}
+
+// Return the table of all products in the field, building it on first use.
+func (f *Field) productTable() *[256][256]uint8 {
+	f.prodOnce.Do(func() {
+		t := new([256][256]uint8)
+		for a := range t {
+			f.mulTable(uint8(a), &t[a])
+		}
+		f.prod = t
+	})
+	return f.prod
+}
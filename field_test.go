@@ -0,0 +1,88 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDefaultField(t *testing.T) {
+	f := DefaultField()
+	if f.Polynomial() != 0x11D {
+		t.Errorf("default polynomial %#x, want 0x11D", f.Polynomial())
+	}
+	if cp, err := DetectPolynomial(f.exp[:], f.log[:]); cp != f.Polynomial() || err != nil {
+		t.Errorf("DetectPolynomial = %#x, %v", cp, err)
+	}
+	if exp != &f.exp || log != &f.log || inv != &f.inv {
+		t.Error("the package tables are not the default field's")
+	}
+	for a := 0; a < 256; a++ {
+		for b := 0; b < 256; b++ {
+			if f.Mul(uint8(a), uint8(b)) != mult(uint8(a), uint8(b)) {
+				t.Fatalf("default field disagrees with mult at %d * %d", a, b)
+			}
+		}
+	}
+}
+
+func TestNewField(t *testing.T) {
+	f, err := NewField(0x12D)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp, err := DetectPolynomial(f.exp[:], f.log[:]); cp != 0x12D || err != nil {
+		t.Errorf("DetectPolynomial = %#x, %v", cp, err)
+	}
+	for a := 1; a < 256; a++ {
+		if f.Mul(uint8(a), f.Inv(uint8(a))) != 1 {
+			t.Fatalf("%d * Inv(%d) != 1", a, a)
+		}
+		for b := 0; b < 256; b++ {
+			if f.Mul(uint8(a), uint8(b)) != poly_multiply(uint8(a), uint8(b), 0x12D) {
+				t.Fatalf("Mul(%d, %d) is wrong", a, b)
+			}
+		}
+	}
+
+	// 0x11B is irreducible but not primitive: x has order 51.
+	for _, poly := range []uint16{0x100, 0x101, 0x11F, 0xff, 0x21D, 0x11B} {
+		if _, err := NewField(poly); err == nil {
+			t.Errorf("NewField(%#x) succeeded", poly)
+		}
+	}
+}
+
+func TestErasureCoderField(t *testing.T) {
+	f, err := NewField(0x12D)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := [][]byte{
+		[]byte{1, 2, 3, 4, 5},
+		[]byte{41, 42, 43, 44, 45},
+		[]byte{11, 22, 33, 44, 55},
+	}
+	parity := NewErasureCoderField(f, []byte{10, 200, 77}, []byte{130, 250}).Code(in)
+	if bytes.Equal(parity[0], NewErasureCoder([]byte{10, 200, 77}, []byte{130, 250}).Code(in)[0]) {
+		t.Error("parity in 0x12D equals parity in 0x11D")
+	}
+
+	out := NewErasureCoderField(f, []byte{200, 130, 250}, []byte{10, 77}).Code([][]byte{in[1], parity[0], parity[1]})
+	if !bytes.Equal(out[0], in[0]) || !bytes.Equal(out[1], in[2]) {
+		t.Error("reconstruction in 0x12D failed")
+	}
+}
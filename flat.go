@@ -0,0 +1,79 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import "fmt"
+
+// CodeFlat is like CodeInto, but for matrices laid out in single
+// buffers rather than as slices of rows: input i is
+// in[i*in_stride:i*in_stride+n] and output k is
+// out[k*out_stride:k*out_stride+n].  The strides must be at least n, so
+// the rows don't overlap, and the buffers must hold Degree() and
+// NumOutputs() rows respectively; the gaps between rows are neither
+// read nor written.  The output rows are zeroed first.  No memory is
+// allocated, so coding block after block into the same buffers leaves
+// nothing for the garbage collector.
+func (p *ErasureCoder) CodeFlat(in []uint8, in_stride, n int, out []uint8, out_stride int) {
+	if err := flatError("in", len(in), in_stride, n, len(p.interp)); err != nil {
+		fail(err)
+		return
+	}
+	if err := flatError("out", len(out), out_stride, n, len(p.interp[0])); err != nil {
+		fail(err)
+		return
+	}
+
+	for k := range p.interp[0] {
+		row := out[k*out_stride : k*out_stride+n]
+		for j := range row {
+			row[j] = 0
+		}
+	}
+	for i := range p.interp {
+		src := in[i*in_stride : i*in_stride+n : i*in_stride+n]
+		for k := range p.interp[i] {
+			p.mulAdd(out[k*out_stride:k*out_stride+n:k*out_stride+n], src, i, k)
+		}
+	}
+}
+
+// UpdateFlat is like Update, but for outputs laid out as by CodeFlat:
+// output k is out[k*out_stride:k*out_stride+len(in_delta)].
+func (p *ErasureCoder) UpdateFlat(idx uint8, in_delta []uint8, out []uint8, out_stride int) {
+	if int(idx) >= len(p.interp) {
+		fail(fmt.Errorf("Abscissa index out of range %d for polynomial of degree %d", idx, len(p.interp)))
+		return
+	}
+	n := len(in_delta)
+	if err := flatError("out", len(out), out_stride, n, len(p.interp[0])); err != nil {
+		fail(err)
+		return
+	}
+	for k := range p.interp[idx] {
+		p.mulAdd(out[k*out_stride:k*out_stride+n:k*out_stride+n], in_delta, int(idx), k)
+	}
+}
+
+// flatError checks that a buffer of length l holds rows rows of n
+// bytes at the given stride.
+func flatError(name string, l, stride, n, rows int) error {
+	if n < 0 || stride < n {
+		return fmt.Errorf("Bad %s stride %d for rows of %d bytes", name, stride, n)
+	}
+	if need := (rows-1)*stride + n; l < need {
+		return fmt.Errorf("Flat %s matrix too short: %d < %d bytes for %d rows of %d at stride %d", name, l, need, rows, n, stride)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCodeFlat(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2, 3}, []byte{4, 5, 6})
+	for _, s := range []struct{ n, in_stride, out_stride int }{{100, 100, 100}, {100, 128, 101}, {0, 0, 0}, {1, 7, 1}} {
+		rows := randomMatrix(4, s.n, 3)
+		want := c.Code(rows)
+
+		in := make([]byte, 3*s.in_stride+s.n)
+		for i := range rows {
+			copy(in[i*s.in_stride:], rows[i])
+		}
+		out := bytes.Repeat([]byte{0xAA}, 2*s.out_stride+s.n)
+		c.CodeFlat(in, s.in_stride, s.n, out, s.out_stride)
+		for k := range want {
+			if !bytes.Equal(out[k*s.out_stride:k*s.out_stride+s.n], want[k]) {
+				t.Errorf("%v: output %d differs", s, k)
+			}
+		}
+		for k := 0; k < 2; k++ {
+			for _, v := range out[k*s.out_stride+s.n : (k+1)*s.out_stride] {
+				if v != 0xAA {
+					t.Fatalf("%v: gap after output %d overwritten", s, k)
+				}
+			}
+		}
+	}
+}
+
+func TestCodeFlatPanicOnShortBuffer(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1}, []byte{2})
+	defer recoverExpected(t)
+	c.CodeFlat(make([]byte, 19), 10, 10, make([]byte, 10), 10) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestCodeFlatPanicOnStride(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1}, []byte{2})
+	defer recoverExpected(t)
+	c.CodeFlat(make([]byte, 20), 5, 10, make([]byte, 10), 10) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestUpdateFlat(t *testing.T) {
+	const n, stride = 100, 128
+	c := NewErasureCoder([]byte{0, 1, 2, 3}, []byte{4, 5, 6})
+	in := randomMatrix(4, n, 3)
+	out := make([]byte, 2*stride+n)
+	flat := make([]byte, 4*n)
+	for i := range in {
+		copy(flat[i*n:], in[i])
+	}
+	c.CodeFlat(flat, n, n, out, stride)
+
+	delta := randomMatrix(1, n, 9)[0]
+	c.UpdateFlat(2, delta, out, stride)
+	addSlice(in[2], delta)
+	want := c.Code(in)
+	for k := range want {
+		if !bytes.Equal(out[k*stride:k*stride+n], want[k]) {
+			t.Errorf("output %d wrong after UpdateFlat", k)
+		}
+	}
+}
+
+func TestUpdateFlatPanicOnIndex(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1}, []byte{2})
+	defer recoverExpected(t)
+	c.UpdateFlat(2, make([]byte, 10), make([]byte, 10), 10) // should panic
+	t.Error("Failed to panic")
+}
+
+func BenchmarkCodeFlat(b *testing.B) {
+	const n = 128 << 10
+	c := NewErasureCoder([]byte{0, 1, 2, 3}, []byte{4, 5})
+	in := randomMatrix(1, 4*n, 1)[0]
+	out := make([]byte, 2*n)
+	b.SetBytes(4 * n)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.CodeFlat(in, n, n, out, n)
+	}
+}
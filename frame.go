@@ -0,0 +1,97 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Parity shards that are maintained incrementally with Update can be
+// framed with the epoch, or generation, of the data they were computed
+// from, so that parity left over from an earlier write is not mixed
+// with current parity during reconstruction, which would silently
+// produce garbage.  A framed shard is
+//
+//	"RSPE"  4 bytes magic
+//	epoch   8 bytes, big endian
+//	parity  the rest
+const frameHeaderLen = 12
+
+var frameMagic = []byte("RSPE")
+
+// ErrStaleParity is returned by UnframeParity for parity of the wrong epoch.
+var ErrStaleParity = errors.New("Stale parity")
+
+// FrameParity returns a new framed copy of the parity shard for epoch.
+func FrameParity(epoch uint64, shard []uint8) []uint8 {
+	b := make([]uint8, frameHeaderLen+len(shard))
+	copy(b, frameMagic)
+	binary.BigEndian.PutUint64(b[4:], epoch)
+	copy(b[frameHeaderLen:], shard)
+	return b
+}
+
+// ParityEpoch returns the epoch in the header of a framed parity shard.
+func ParityEpoch(framed []uint8) (uint64, error) {
+	if len(framed) < frameHeaderLen || string(framed[:4]) != string(frameMagic) {
+		return 0, fmt.Errorf("Not a framed parity shard")
+	}
+	return binary.BigEndian.Uint64(framed[4:]), nil
+}
+
+// UnframeParity returns the parity in a framed shard, which aliases
+// framed[], if it was written for epoch, and ErrStaleParity if not.
+func UnframeParity(framed []uint8, epoch uint64) ([]uint8, error) {
+	e, err := ParityEpoch(framed)
+	if err != nil {
+		return nil, err
+	}
+	if e != epoch {
+		return nil, fmt.Errorf("%w: epoch %d, want %d", ErrStaleParity, e, epoch)
+	}
+	return framed[frameHeaderLen:], nil
+}
+
+// UpdateFramed is Update on framed parity shards.  All of framed[] must
+// carry the same epoch; after applying the update in place they carry
+// the next one, which is returned.  If the epochs disagree nothing is
+// modified and an error wrapping ErrStaleParity is returned.
+func (p *ErasureCoder) UpdateFramed(idx uint8, in_delta []uint8, framed [][]uint8) (epoch uint64, err error) {
+	out := make([][]uint8, len(framed))
+	for k, f := range framed {
+		e, err := ParityEpoch(f)
+		if err != nil {
+			return 0, err
+		}
+		if k == 0 {
+			epoch = e
+		} else if e != epoch {
+			return 0, fmt.Errorf("%w: parity %d has epoch %d, parity 0 has %d", ErrStaleParity, k, e, epoch)
+		}
+		out[k] = f[frameHeaderLen:]
+	}
+	if err := p.updateError(idx, in_delta, out); err != nil {
+		return 0, err
+	}
+
+	p.Update(idx, in_delta, out)
+	epoch++
+	for _, f := range framed {
+		binary.BigEndian.PutUint64(f[4:], epoch)
+	}
+	return epoch, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestFramedParity(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	in := [][]byte{
+		[]byte{1, 2, 3, 4, 5},
+		[]byte{41, 42, 43, 44, 45},
+		[]byte{11, 22, 33, 44, 55},
+	}
+	parity := c.Code(in)
+	framed := [][]byte{FrameParity(7, parity[0]), FrameParity(7, parity[1])}
+
+	// Keep a copy of the old parity 1 around, as a lagging replica would.
+	stale := append([]byte(nil), framed[1]...)
+
+	delta := []byte{1, 0, 0, 0, 9}
+	epoch, err := c.UpdateFramed(0, delta, framed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch != 8 {
+		t.Error("epoch after update: ", epoch)
+	}
+	for i := range delta {
+		in[0][i] ^= delta[i]
+	}
+	want := c.Code(in)
+	for k := range framed {
+		got, err := UnframeParity(framed[k], epoch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want[k]) {
+			t.Error(got, " != ", want[k])
+		}
+	}
+
+	if _, err := UnframeParity(stale, epoch); !errors.Is(err, ErrStaleParity) {
+		t.Error("stale parity accepted: ", err)
+	}
+
+	// Mixing the stale replica back in must not update anything.
+	mixed := [][]byte{framed[0], stale}
+	before := append([]byte(nil), framed[0]...)
+	if _, err := c.UpdateFramed(0, delta, mixed); !errors.Is(err, ErrStaleParity) {
+		t.Error("UpdateFramed accepted mixed epochs: ", err)
+	}
+	if !bytes.Equal(before, framed[0]) {
+		t.Error("failed UpdateFramed modified parity")
+	}
+
+	if _, err := UnframeParity([]byte("junk"), epoch); err == nil {
+		t.Error("UnframeParity accepted junk")
+	}
+}
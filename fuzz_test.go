@@ -0,0 +1,128 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Return the distinct values of x, in order, at most max of them.
+func distinct(x []byte, max int) []byte {
+	var seen [256]bool
+	var d []byte
+	for _, v := range x {
+		if !seen[v] && len(d) < max {
+			seen[v] = true
+			d = append(d, v)
+		}
+	}
+	return d
+}
+
+// Split data into k rows of equal length, dropping the remainder.
+func splitRows(data []byte, k int) [][]byte {
+	n := len(data) / k
+	rows := make([][]byte, k)
+	for i := range rows {
+		rows[i] = data[i*n : (i+1)*n]
+	}
+	return rows
+}
+
+func addFuzzSeeds(f *testing.F) {
+	f.Add([]byte{0, 1, 2}, []byte{0, 1, 2, 3, 4}, []byte("Hello, world! 0123456789"))
+	f.Add([]byte{0, 3, 4}, []byte{1, 2}, []byte{1, 2, 3, 4, 5, 6})
+	f.Add([]byte{0, 1, 2, 3}, []byte{4, 5}, bytes.Repeat([]byte{0xFF}, 100))
+	f.Add([]byte{7}, []byte{255}, []byte{})
+}
+
+func FuzzCode(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, in_x, out_x, data []byte) {
+		in_x, out_x = distinct(in_x, 32), distinct(out_x, 32)
+		if len(in_x) == 0 || len(out_x) == 0 {
+			return
+		}
+		k := len(in_x)
+		in := splitRows(data, k)
+		out := NewErasureCoder(in_x, out_x).Code(in)
+
+		// Decode the inputs from as many outputs as possible, and
+		// inputs for the rest.
+		shard := make(map[byte][]byte)
+		for i, x := range in_x {
+			shard[x] = in[i]
+		}
+		for j, x := range out_x {
+			shard[x] = out[j]
+		}
+		surv_x := distinct(append(append([]byte{}, out_x...), in_x...), k)
+		surv := make([][]byte, k)
+		for i, x := range surv_x {
+			surv[i] = shard[x]
+		}
+		dec := NewErasureCoder(surv_x, in_x).Code(surv)
+		for i := range in {
+			if !bytes.Equal(dec[i], in[i]) {
+				t.Fatalf("in_x %v, out_x %v: input %d not decoded from %v", in_x, out_x, i, surv_x)
+			}
+		}
+
+		r, err := NewReconstructor(k, distinct(append(append([]byte{}, in_x...), out_x...), 256))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec, err := r.Reconstruct(surv_x, surv, in_x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range in {
+			if !bytes.Equal(rec[i], in[i]) {
+				t.Fatalf("in_x %v, out_x %v: input %d not reconstructed from %v", in_x, out_x, i, surv_x)
+			}
+		}
+	})
+}
+
+func FuzzUpdate(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, in_x, out_x, data []byte) {
+		in_x, out_x = distinct(in_x, 32), distinct(out_x, 32)
+		if len(in_x) == 0 || len(out_x) == 0 {
+			return
+		}
+		k := len(in_x)
+		rows := splitRows(data, k+1)
+		in, delta := rows[:k], rows[k]
+		idx := 0
+		if len(data) > 0 {
+			idx = int(data[0]) % k
+		}
+
+		c := NewErasureCoder(in_x, out_x)
+		out := c.Code(in)
+		c.Update(uint8(idx), delta, out)
+
+		in[idx] = append([]byte{}, in[idx]...)
+		addSlice(in[idx], delta)
+		want := c.Code(in)
+		for j := range want {
+			if !bytes.Equal(out[j], want[j]) {
+				t.Fatalf("in_x %v, out_x %v: output %d wrong after Update of %d", in_x, out_x, j, idx)
+			}
+		}
+	})
+}
@@ -0,0 +1,107 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import "fmt"
+
+// The arithmetic of the field GF(2^8) the package works in, for use in
+// custom codes and to check computations against the ErasureCoder.
+// The exponent and logarithm base is the generator 2 (the polynomial x).
+
+// Add returns a + b, which is a xor b, and also a - b.
+func Add(a, b uint8) uint8 {
+	return a ^ b
+}
+
+// Mul returns a * b.
+func Mul(a, b uint8) uint8 {
+	return mult(a, b)
+}
+
+// MulSlow returns a * b like Mul, but computed bit by bit rather than
+// looked up in tables.  It is the reference Mul is tested against.
+func MulSlow(a, b uint8) uint8 {
+	return galois_multiply(a, b)
+}
+
+// Inv returns the multiplicative inverse of a.  It panics if a is 0,
+// or returns 0, see SetStrictErrors.
+func Inv(a uint8) uint8 {
+	if a == 0 {
+		fail(fmt.Errorf("Inverse of 0"))
+		return 0
+	}
+	return inv[a]
+}
+
+// Div returns a / b.  It panics if b is 0, or returns 0, see
+// SetStrictErrors.
+func Div(a, b uint8) uint8 {
+	if b == 0 {
+		fail(fmt.Errorf("Division by 0"))
+		return 0
+	}
+	return div(a, b)
+}
+
+// Exp returns 2^n.  n may be negative or larger than 254, the order of
+// the multiplicative group being 255.
+func Exp(n int) uint8 {
+	n %= 255
+	if n < 0 {
+		n += 255
+	}
+	return exp[n]
+}
+
+// Log returns the n in [0, 255) for which 2^n = a.  It panics if a is
+// 0, or returns -1, see SetStrictErrors.
+func Log(a uint8) int {
+	if a == 0 {
+		fail(fmt.Errorf("Logarithm of 0"))
+		return -1
+	}
+	return int(log[a])
+}
+
+// MulSliceXor sets dst[i] ^= src[i] * c for all i.  This is the inner
+// loop of Code, and shares its implementation.  It panics if dst and
+// src are not of the same length, see SetStrictErrors.
+func MulSliceXor(dst, src []uint8, c uint8) {
+	if len(dst) != len(src) {
+		fail(fmt.Errorf("Slices of different lengths: dst %d, src %d", len(dst), len(src)))
+		return
+	}
+	switch c {
+	case 0:
+	case 1:
+		addSlice(dst, src)
+	default:
+		mulAddTable(dst, src, &defaultField.productTable()[c])
+	}
+}
+
+// MulSlice sets dst[i] = src[i] * c for all i.  It panics if dst and
+// src are not of the same length, see SetStrictErrors.
+func MulSlice(dst, src []uint8, c uint8) {
+	if len(dst) != len(src) {
+		fail(fmt.Errorf("Slices of different lengths: dst %d, src %d", len(dst), len(src)))
+		return
+	}
+	tbl := &defaultField.productTable()[c]
+	for j, v := range src {
+		dst[j] = tbl[v]
+	}
+}
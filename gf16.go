@@ -0,0 +1,256 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// GF(2^16) with characteristic polynomial x^16 + x^12 + x^3 + x + 1,
+// for codes with more than the 256 shards GF(2^8) can address.
+const cp_16_12_3_1_0 = 1<<16 | 1<<12 | 1<<3 | 1<<1 | 1<<0
+
+// The GF(2^16) tables take 256KB, so they are only built when the first
+// ErasureCoder16 is constructed.
+var (
+	gf16Once sync.Once
+	exp16    []uint16 // 65535 entries
+	log16    []uint16 // 65536 entries
+)
+
+// multiply the hard way in GF(2^16), only used to build the tables.
+func galois_multiply16(aa, bb uint16) uint16 {
+	var (
+		a uint32 = uint32(aa)
+		b uint32 = uint32(bb)
+		p uint32 = 0
+	)
+	for ; a != 0; a >>= 1 {
+		if a&1 != 0 {
+			p ^= b
+		}
+		b <<= 1
+		if b&(1<<16) != 0 {
+			b ^= cp_16_12_3_1_0
+		}
+	}
+	return uint16(p)
+}
+
+func initGF16() {
+	gf16Once.Do(func() {
+		exp16 = make([]uint16, 65535)
+		log16 = make([]uint16, 65536)
+		var a uint16 = 1
+		for i := range exp16 {
+			exp16[i] = a
+			log16[a] = uint16(i)
+			a = galois_multiply16(a, 2)
+		}
+	})
+}
+
+func mult16(a, b uint16) uint16 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	idx := int(log16[a]) + int(log16[b])
+	if idx >= 65535 {
+		idx -= 65535
+	}
+	return exp16[idx]
+}
+
+func inv16(a uint16) uint16 {
+	return exp16[(65535-int(log16[a]))%65535]
+}
+
+// An ErasureCoder16 is an ErasureCoder over GF(2^16): its abscissae and
+// symbols are uint16s, so it can address up to 65536 shards.  The
+// price, besides slower arithmetic, is 256KB of tables, built when the
+// first ErasureCoder16 is constructed.  Like ErasureCoder, it is
+// immutable and safe for concurrent use.
+type ErasureCoder16 struct {
+	interp [][]uint16 // the Lagrange interpolation factors
+}
+
+// NewErasureCoder16 is NewErasureCoder over GF(2^16).  Like there, the
+// in_x[] must be non-empty and distinct, and so must the out_x[].
+func NewErasureCoder16(in_x, out_x []uint16) (p *ErasureCoder16) {
+	if len(in_x) == 0 {
+		fail(fmt.Errorf("No abscissae in in_x"))
+		return nil
+	}
+	if err := abscissaeError16("in_x", in_x); err != nil {
+		fail(err)
+		return nil
+	}
+	if err := abscissaeError16("out_x", out_x); err != nil {
+		fail(err)
+		return nil
+	}
+	initGF16()
+	p = new(ErasureCoder16)
+	p.interp = make([][]uint16, len(in_x))
+	for i := range in_x {
+		p.interp[i] = make([]uint16, len(out_x))
+		for j, xj := range out_x {
+			var r uint16 = 1
+			for k, xk := range in_x {
+				if k != i {
+					r = mult16(r, mult16(xj^xk, inv16(in_x[i]^xk)))
+				}
+			}
+			p.interp[i][j] = r
+		}
+	}
+	return
+}
+
+// abscissaeError over GF(2^16).
+func abscissaeError16(name string, x []uint16) error {
+	if len(x) > 1<<16 {
+		return fmt.Errorf("Too many abscissae in %s: %d, GF(2^16) has only 65536", name, len(x))
+	}
+	seen := make([]bool, 1<<16)
+	for _, v := range x {
+		if seen[v] {
+			return fmt.Errorf("Abscissa %d appears twice in %s", v, name)
+		}
+		seen[v] = true
+	}
+	return nil
+}
+
+// Return the degree of the computed polynomial, which is equal to the number of inputs.
+func (p *ErasureCoder16) Degree() int {
+	return len(p.interp)
+}
+
+// Return the number of outputs the ErasureCoder16 will compute.
+func (p *ErasureCoder16) NumOutputs() int {
+	return len(p.interp[0])
+}
+
+// Code is ErasureCoder.Code over GF(2^16).
+func (p *ErasureCoder16) Code(in [][]uint16) (out [][]uint16) {
+	if len(in) != p.Degree() {
+		fail(fmt.Errorf("Wrong number of inputs: %d for Erasure coder of degree: %d", len(in), p.Degree()))
+		return nil
+	}
+	for i := 0; i < len(in); i++ {
+		if len(in[i]) != len(in[0]) {
+			fail(fmt.Errorf("Ragged input matrix: [0]%d != [%d]%d  ", len(in[0]), i, len(in[i])))
+			return nil
+		}
+	}
+
+	out = make([][]uint16, p.NumOutputs())
+	for k := range out {
+		out[k] = make([]uint16, len(in[0]))
+	}
+	for i := range in {
+		for k, c := range p.interp[i] {
+			if c == 0 {
+				continue
+			}
+			for j, v := range in[i] {
+				out[k][j] ^= mult16(v, c)
+			}
+		}
+	}
+	return
+}
+
+// Update is ErasureCoder.Update over GF(2^16).
+func (p *ErasureCoder16) Update(idx int, in_delta []uint16, out [][]uint16) {
+	if idx < 0 || idx >= len(p.interp) {
+		fail(fmt.Errorf("Abscissa index out of range %d for polynomial of degree %d", idx, len(p.interp)))
+		return
+	}
+	if len(out) != p.NumOutputs() {
+		fail(fmt.Errorf("Wrong number of in/outputs: %d != %d", len(out), p.NumOutputs()))
+		return
+	}
+	for i := 0; i < len(out); i++ {
+		if len(in_delta) != len(out[i]) {
+			fail(fmt.Errorf("Ragged or uneven input matrices: in %d != out[%d]%d  ", len(in_delta), i, len(out[i])))
+			return
+		}
+	}
+
+	for k, c := range p.interp[idx] {
+		if c == 0 {
+			continue
+		}
+		for j, v := range in_delta {
+			out[k][j] ^= mult16(v, c)
+		}
+	}
+}
+
+// Shards of GF(2^16) symbols are stored and sent as bytes, two per
+// symbol, and other implementations differ in which byte comes first.
+// The package itself has no preference, so the functions that convert
+// take the byte order explicitly; binary.BigEndian, the order of the
+// package's own formats like TOC, is the one to use absent a reason
+// to do otherwise.
+
+// PackSymbols16 returns the symbols as bytes in the given order.
+func PackSymbols16(symbols []uint16, order binary.ByteOrder) []uint8 {
+	b := make([]uint8, 2*len(symbols))
+	for j, v := range symbols {
+		order.PutUint16(b[2*j:], v)
+	}
+	return b
+}
+
+// UnpackSymbols16 returns the symbols packed into b[] in the given
+// order.  It is an error if b has an odd length.
+func UnpackSymbols16(b []uint8, order binary.ByteOrder) ([]uint16, error) {
+	if len(b)%2 != 0 {
+		return nil, fmt.Errorf("Odd number of bytes %d for 16 bit symbols", len(b))
+	}
+	symbols := make([]uint16, len(b)/2)
+	for j := range symbols {
+		symbols[j] = order.Uint16(b[2*j:])
+	}
+	return symbols, nil
+}
+
+// CodeBytes is Code for shards of bytes holding symbols in the given
+// order, with the outputs in the same order.  It panics like Code,
+// and if a shard has an odd length.
+func (p *ErasureCoder16) CodeBytes(in [][]uint8, order binary.ByteOrder) (out [][]uint8) {
+	symbols := make([][]uint16, len(in))
+	for i := range in {
+		var err error
+		if symbols[i], err = UnpackSymbols16(in[i], order); err != nil {
+			fail(fmt.Errorf("Input %d: %v", i, err))
+			return nil
+		}
+	}
+	res := p.Code(symbols)
+	if res == nil {
+		return nil
+	}
+	out = make([][]uint8, len(res))
+	for k := range res {
+		out[k] = PackSymbols16(res[k], order)
+	}
+	return
+}
@@ -0,0 +1,148 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestGF16Tables(t *testing.T) {
+	initGF16()
+	// 2 must generate the whole multiplicative group, or log16 has holes.
+	seen := make([]bool, 65536)
+	for _, v := range exp16 {
+		if v == 0 || seen[v] {
+			t.Fatalf("x^16 + x^12 + x^3 + x + 1 is not primitive: %d", v)
+		}
+		seen[v] = true
+	}
+	for a := 1; a < 65536; a += 97 {
+		for b := 1; b < 65536; b += 101 {
+			if mult16(uint16(a), uint16(b)) != galois_multiply16(uint16(a), uint16(b)) {
+				t.Fatalf("mult16(%d, %d) is wrong", a, b)
+			}
+		}
+		if mult16(uint16(a), inv16(uint16(a))) != 1 {
+			t.Fatalf("inv16(%d) is wrong", a)
+		}
+	}
+}
+
+func TestErasureCoder16(t *testing.T) {
+	// 300 shards: more than GF(2^8) can address.
+	const k, m, n = 290, 10, 7
+	in_x := make([]uint16, k)
+	out_x := make([]uint16, m)
+	for i := range in_x {
+		in_x[i] = uint16(i)
+	}
+	for i := range out_x {
+		out_x[i] = uint16(1000 + i)
+	}
+	in := make([][]uint16, k)
+	for i := range in {
+		in[i] = make([]uint16, n)
+		for j := range in[i] {
+			in[i][j] = uint16(i*7919 + j*104729)
+		}
+	}
+	parity := NewErasureCoder16(in_x, out_x).Code(in)
+
+	// Lose the first 10 data shards, recover them from the rest plus parity.
+	surv_x := append(append([]uint16(nil), in_x[m:]...), out_x...)
+	surv := append(append([][]uint16(nil), in[m:]...), parity...)
+	rec := NewErasureCoder16(surv_x, in_x[:m]).Code(surv)
+	for i := 0; i < m; i++ {
+		for j := range in[i] {
+			if rec[i][j] != in[i][j] {
+				t.Fatalf("shard %d not recovered", i)
+			}
+		}
+	}
+
+	// Update data shard 5 and check against a fresh encode.
+	c := NewErasureCoder16(in_x, out_x)
+	delta := []uint16{1, 2, 3, 4, 5, 6, 0xffff}
+	c.Update(5, delta, parity)
+	for j := range delta {
+		in[5][j] ^= delta[j]
+	}
+	want := c.Code(in)
+	for i := range want {
+		for j := range want[i] {
+			if parity[i][j] != want[i][j] {
+				t.Fatal("Update disagrees with Code")
+			}
+		}
+	}
+}
+
+func TestErasureCoder16PanicOnRepeatedAbscissa(t *testing.T) {
+	defer recoverExpected(t)
+	NewErasureCoder16([]uint16{1000, 7, 1000}, []uint16{3}) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestErasureCoder16PanicOnRepeatedOutput(t *testing.T) {
+	defer recoverExpected(t)
+	NewErasureCoder16([]uint16{1, 2}, []uint16{300, 300}) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestErasureCoder16PanicOnNoInputs(t *testing.T) {
+	defer recoverExpected(t)
+	NewErasureCoder16(nil, []uint16{3}) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestCodeBytes16(t *testing.T) {
+	// Fixtures for the line through 0 and 1, evaluated at 300 and 1000,
+	// with the symbols 0x1234, 0xabcd and 0x0001, 0xfffe read in either
+	// order.  The big-endian parity is P(x) = a + (a + b) x for the
+	// symbols a = 0x1234 and b = 0x0001, e.g.
+	// 0x1234 ^ galois_multiply16(0x1235, 300) == 0xa853.
+	c := NewErasureCoder16([]uint16{0, 1}, []uint16{300, 1000})
+	in := [][]byte{{0x12, 0x34, 0xab, 0xcd}, {0x00, 0x01, 0xff, 0xfe}}
+	for _, f := range []struct {
+		order binary.ByteOrder
+		want  [][]byte
+	}{
+		{binary.BigEndian, [][]byte{{0xa8, 0x53, 0x6d, 0xd1}, {0xac, 0x62, 0xbb, 0x04}}},
+		{binary.LittleEndian, [][]byte{{0x51, 0xe9, 0x3a, 0xd5}, {0xc7, 0x77, 0x56, 0x8c}}},
+	} {
+		out := c.CodeBytes(in, f.order)
+		for k := range f.want {
+			if !bytes.Equal(out[k], f.want[k]) {
+				t.Errorf("%v: output %d is %x, want %x", f.order, k, out[k], f.want[k])
+			}
+		}
+	}
+	if v := 0x1234 ^ galois_multiply16(0x1235, 300); v != 0xa853 {
+		t.Errorf("P(300) = %#x", v)
+	}
+
+	symbols := []uint16{0x0102, 0xfffe}
+	if b := PackSymbols16(symbols, binary.LittleEndian); !bytes.Equal(b, []byte{2, 1, 0xfe, 0xff}) {
+		t.Errorf("PackSymbols16: %x", b)
+	}
+	if s, err := UnpackSymbols16(PackSymbols16(symbols, binary.BigEndian), binary.BigEndian); err != nil || s[0] != 0x0102 || s[1] != 0xfffe {
+		t.Error("UnpackSymbols16: ", s, err)
+	}
+	if _, err := UnpackSymbols16([]byte{1, 2, 3}, binary.BigEndian); err == nil {
+		t.Error("UnpackSymbols16 accepted an odd length")
+	}
+}
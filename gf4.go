@@ -0,0 +1,187 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import "fmt"
+
+// GF(2^4) with characteristic polynomial x^4 + x + 1, for tiny codes of
+// up to 16 shards whose symbols are nibbles, packed two to a byte.
+const cp_4_1_0 = 1<<4 | 1<<1 | 1<<0
+
+// multiply the hard way in GF(2^4).  The field is small enough that
+// the full product table is built from this directly.
+func galois_multiply4(a, b uint8) uint8 {
+	var p uint8
+	for ; a != 0; a >>= 1 {
+		if a&1 != 0 {
+			p ^= b
+		}
+		b <<= 1
+		if b&(1<<4) != 0 {
+			b ^= cp_4_1_0
+		}
+	}
+	return p
+}
+
+var mul4, inv4 = gf4Tables()
+
+func gf4Tables() (mul [16][16]uint8, inv [16]uint8) {
+	for a := range mul {
+		for b := range mul[a] {
+			mul[a][b] = galois_multiply4(uint8(a), uint8(b))
+			if mul[a][b] == 1 {
+				inv[a] = uint8(b)
+			}
+		}
+	}
+	return
+}
+
+// An ErasureCoder4 is an ErasureCoder over GF(2^4): its abscissae are
+// 0...15 and its symbols nibbles.  Rows are of bytes each holding two
+// symbols, which are coded independently, so the packing is up to the
+// caller; Pack4 and Unpack4 put symbols low nibble first.  Since
+// multiplication by a constant is linear, the product table of a
+// factor for a pair of nibbles is again a 256 byte table, and the
+// ErasureCoder4 multiplies exactly as fast as an ErasureCoder.  Like
+// ErasureCoder, it is immutable and safe for concurrent use.
+type ErasureCoder4 struct {
+	interp [][]uint8       // the Lagrange interpolation factors
+	tables [][]*[256]uint8 // the product tables of interp, for nibble pairs
+}
+
+// NewErasureCoder4 is NewErasureCoder over GF(2^4).  The abscissae
+// must be less than 16, and distinct.
+func NewErasureCoder4(in_x, out_x []uint8) (p *ErasureCoder4) {
+	if err := coderAbscissaeError(in_x, out_x); err != nil {
+		fail(err)
+		return nil
+	}
+	for _, x := range append(append([]uint8(nil), in_x...), out_x...) {
+		if x >= 16 {
+			fail(fmt.Errorf("Abscissa %d out of range for GF(2^4)", x))
+			return nil
+		}
+	}
+
+	var byCoef [16]*[256]uint8
+	p = new(ErasureCoder4)
+	p.interp = makeMatrix(len(in_x), len(out_x))
+	p.tables = make([][]*[256]uint8, len(in_x))
+	for i := range in_x {
+		p.tables[i] = make([]*[256]uint8, len(out_x))
+		for j, xj := range out_x {
+			var r uint8 = 1
+			for k, xk := range in_x {
+				if k != i {
+					r = mul4[r][mul4[xj^xk][inv4[in_x[i]^xk]]]
+				}
+			}
+			p.interp[i][j] = r
+			if byCoef[r] == nil {
+				byCoef[r] = new([256]uint8)
+				for b := range byCoef[r] {
+					byCoef[r][b] = mul4[r][b&15] | mul4[r][b>>4]<<4
+				}
+			}
+			p.tables[i][j] = byCoef[r]
+		}
+	}
+	return
+}
+
+// Return the degree of the computed polynomial, which is equal to the number of inputs.
+func (p *ErasureCoder4) Degree() int {
+	return len(p.interp)
+}
+
+// Return the number of outputs the ErasureCoder4 will compute.
+func (p *ErasureCoder4) NumOutputs() int {
+	return len(p.interp[0])
+}
+
+// Code is ErasureCoder.Code over GF(2^4), on rows of packed nibbles.
+func (p *ErasureCoder4) Code(in [][]uint8) (out [][]uint8) {
+	if len(in) != p.Degree() {
+		fail(fmt.Errorf("Wrong number of inputs: %d for Erasure coder of degree: %d", len(in), p.Degree()))
+		return nil
+	}
+	for i := 0; i < len(in); i++ {
+		if len(in[i]) != len(in[0]) {
+			fail(fmt.Errorf("Ragged input matrix: [0]%d != [%d]%d, row lengths %s", len(in[0]), i, len(in[i]), rowLengths(in)))
+			return nil
+		}
+	}
+
+	out = makeMatrix(p.NumOutputs(), len(in[0]))
+	for i := range in {
+		for k, c := range p.interp[i] {
+			if c != 0 {
+				mulAddTable(out[k], in[i], p.tables[i][k])
+			}
+		}
+	}
+	return
+}
+
+// Update is ErasureCoder.Update over GF(2^4), on rows of packed nibbles.
+func (p *ErasureCoder4) Update(idx int, in_delta []uint8, out [][]uint8) {
+	if idx < 0 || idx >= len(p.interp) {
+		fail(fmt.Errorf("Abscissa index out of range %d for polynomial of degree %d", idx, len(p.interp)))
+		return
+	}
+	if len(out) != p.NumOutputs() {
+		fail(fmt.Errorf("Wrong number of in/outputs: %d != %d", len(out), p.NumOutputs()))
+		return
+	}
+	for i := 0; i < len(out); i++ {
+		if len(in_delta) != len(out[i]) {
+			fail(fmt.Errorf("Ragged or uneven input matrices: in %d != out[%d]%d, out row lengths %s", len(in_delta), i, len(out[i]), rowLengths(out)))
+			return
+		}
+	}
+
+	for k, c := range p.interp[idx] {
+		if c != 0 {
+			mulAddTable(out[k], in_delta, p.tables[idx][k])
+		}
+	}
+}
+
+// Pack4 returns the nibble symbols[] packed two to a byte, the first of
+// each pair in the low nibble.  An odd last symbol is paired with 0.
+// The high nibbles of symbols[] are ignored.
+func Pack4(symbols []uint8) []uint8 {
+	packed := make([]uint8, (len(symbols)+1)/2)
+	for j, s := range symbols {
+		packed[j/2] |= (s & 15) << (4 * uint(j&1))
+	}
+	return packed
+}
+
+// Unpack4 returns the first n symbols packed in packed[] by Pack4, one
+// per byte.
+func Unpack4(packed []uint8, n int) []uint8 {
+	if n < 0 || n > 2*len(packed) {
+		fail(fmt.Errorf("Can't unpack %d symbols from %d bytes", n, len(packed)))
+		return nil
+	}
+	symbols := make([]uint8, n)
+	for j := range symbols {
+		symbols[j] = packed[j/2] >> (4 * uint(j&1)) & 15
+	}
+	return symbols
+}
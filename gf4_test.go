@@ -0,0 +1,105 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGF4Tables(t *testing.T) {
+	// 2 must generate the whole multiplicative group.
+	seen := make(map[uint8]bool)
+	for a, i := uint8(1), 0; i < 15; i++ {
+		if seen[a] {
+			t.Fatalf("x^4 + x + 1 is not primitive: %d", a)
+		}
+		seen[a] = true
+		a = mul4[a][2]
+	}
+	for a := 1; a < 16; a++ {
+		if mul4[a][inv4[a]] != 1 {
+			t.Errorf("inv4(%d) is wrong", a)
+		}
+		for b := 0; b < 16; b++ {
+			if mul4[a][b] != mul4[b][a] {
+				t.Errorf("mul4 is not commutative at %d, %d", a, b)
+			}
+		}
+	}
+}
+
+func TestErasureCoder4(t *testing.T) {
+	// 10 data and 6 parity shards: all of GF(2^4).
+	in_x := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	out_x := []byte{10, 11, 12, 13, 14, 15}
+	in := randomMatrix(10, 301, 4)
+	parity := NewErasureCoder4(in_x, out_x).Code(in)
+
+	// Decode from the parity and the last four inputs.
+	dec := NewErasureCoder4([]byte{10, 11, 12, 13, 14, 15, 6, 7, 8, 9}, []byte{0, 1, 2, 3, 4, 5})
+	rec := dec.Code(append(append([][]byte{}, parity...), in[6:]...))
+	for i := range rec {
+		if !bytes.Equal(rec[i], in[i]) {
+			t.Errorf("input %d not recovered", i)
+		}
+	}
+
+	// Each nibble is a symbol of its own: the low nibbles of the
+	// parity are those of the low nibbles of the inputs.
+	lo := make([][]byte, len(in))
+	for i := range in {
+		lo[i] = make([]byte, len(in[i]))
+		for j, v := range in[i] {
+			lo[i][j] = v & 15
+		}
+	}
+	for k, row := range NewErasureCoder4(in_x, out_x).Code(lo) {
+		for j, v := range row {
+			if v != parity[k][j]&15 {
+				t.Fatalf("parity %d, column %d: low nibble %d != %d", k, j, v, parity[k][j]&15)
+			}
+		}
+	}
+
+	// Update keeps the parity current.
+	c := NewErasureCoder4(in_x, out_x)
+	delta := randomMatrix(1, 301, 5)[0]
+	c.Update(3, delta, parity)
+	addSlice(in[3], delta)
+	want := c.Code(in)
+	for k := range want {
+		if !bytes.Equal(parity[k], want[k]) {
+			t.Errorf("parity %d wrong after Update", k)
+		}
+	}
+}
+
+func TestErasureCoder4PanicOnAbscissa(t *testing.T) {
+	defer recoverExpected(t)
+	NewErasureCoder4([]byte{0, 1}, []byte{16}) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestPack4(t *testing.T) {
+	symbols := []byte{1, 2, 3, 4, 15}
+	packed := Pack4(symbols)
+	if !bytes.Equal(packed, []byte{0x21, 0x43, 0x0F}) {
+		t.Errorf("Pack4: %x", packed)
+	}
+	if got := Unpack4(packed, 5); !bytes.Equal(got, symbols) {
+		t.Error("Unpack4: ", got)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFieldArithmetic(t *testing.T) {
+	for a := 0; a < 256; a++ {
+		x := uint8(a)
+		if Add(x, x) != 0 {
+			t.Errorf("%d + %d != 0", x, x)
+		}
+		if x == 0 {
+			continue
+		}
+		if Mul(x, Inv(x)) != 1 {
+			t.Errorf("%d * Inv(%d) != 1", x, x)
+		}
+		if Exp(Log(x)) != x || Exp(Log(x)+255) != x || Exp(Log(x)-255) != x {
+			t.Errorf("Exp(Log(%d)) != %d", x, x)
+		}
+		for b := 1; b < 256; b++ {
+			y := uint8(b)
+			if Mul(Div(x, y), y) != x {
+				t.Errorf("(%d / %d) * %d != %d", x, y, y, x)
+			}
+			if MulSlow(x, y) != Mul(x, y) {
+				t.Errorf("MulSlow(%d, %d) != Mul(%d, %d)", x, y, x, y)
+			}
+		}
+	}
+	if Exp(1) != 2 || Log(2) != 1 {
+		t.Error("generator is not 2")
+	}
+}
+
+func TestInvPanicOnZero(t *testing.T) {
+	defer recoverExpected(t)
+	Inv(0) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestLogPanicOnZero(t *testing.T) {
+	defer recoverExpected(t)
+	Log(0) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestMulSlice(t *testing.T) {
+	src := make([]uint8, 256)
+	for i := range src {
+		src[i] = uint8(i)
+	}
+	for c := 0; c < 256; c++ {
+		dst := make([]uint8, 256)
+		MulSlice(dst, src, uint8(c))
+		acc := append([]uint8(nil), src...)
+		MulSliceXor(acc, src, uint8(c))
+		for i, v := range src {
+			if p := Mul(v, uint8(c)); dst[i] != p || acc[i] != v^p {
+				t.Fatalf("c = %d, src = %d: MulSlice %d, MulSliceXor %d, want %d", c, v, dst[i], acc[i], p)
+			}
+		}
+	}
+}
+
+func TestMulSlicePanicOnLengthMismatch(t *testing.T) {
+	defer recoverExpected(t)
+	MulSliceXor(make([]uint8, 3), make([]uint8, 4), 7) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestStrictErrorsArithmetic(t *testing.T) {
+	SetStrictErrors(true)
+	defer SetStrictErrors(false)
+	f, _ := NewField(0x11D)
+	dst := []uint8{1, 2, 3}
+	for _, c := range []struct {
+		name string
+		call func() int
+		want int
+	}{
+		{"Inv(0)", func() int { return int(Inv(0)) }, 0},
+		{"Div(1, 0)", func() int { return int(Div(1, 0)) }, 0},
+		{"Log(0)", func() int { return Log(0) }, -1},
+		{"Field.Inv(0)", func() int { return int(f.Inv(0)) }, 0},
+		{"MulSlice", func() int { MulSlice(dst, make([]uint8, 4), 7); return int(dst[0]) }, 1},
+		{"MulSliceXor", func() int { MulSliceXor(dst, make([]uint8, 4), 7); return int(dst[0]) }, 1},
+	} {
+		if got := c.call(); got != c.want {
+			t.Errorf("%s = %d, want %d", c.name, got, c.want)
+		}
+		if LastError() == nil {
+			t.Errorf("%s recorded no error", c.name)
+		}
+	}
+}
+
+// The word-at-a-time loops of addSlice and mulAddTableGeneric against
+// the byte loops, at all lengths and offsets around a word.
+func TestAddSliceWords(t *testing.T) {
+	var tbl [256]uint8
+	mulTable(0x53, &tbl)
+	src := randomMatrix(1, 64, 1)[0]
+	for off := 0; off < 8; off++ {
+		for n := 0; off+n <= 40; n++ {
+			s := src[off : off+n]
+			dst := randomMatrix(2, 40, byte(n))
+			want := append([]byte{}, dst[0]...)
+			for j, v := range s {
+				want[j] ^= v
+			}
+			addSlice(dst[0], s)
+			if !bytes.Equal(dst[0], want) {
+				t.Fatalf("addSlice at %d, %d bytes: %v != %v", off, n, dst[0], want)
+			}
+			want = append(want[:0], dst[1]...)
+			for j, v := range s {
+				want[j] ^= tbl[v]
+			}
+			mulAddTableGeneric(dst[1], s, &tbl)
+			if !bytes.Equal(dst[1], want) {
+				t.Fatalf("mulAddTableGeneric at %d, %d bytes: %v != %v", off, n, dst[1], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import "fmt"
+
+// An Interleaver spreads burst errors over several codewords: it
+// takes depth codewords of n symbols each, back to back, and sends
+// symbol 0 of every codeword, then symbol 1 of every codeword, and so
+// on.  A burst of up to depth*t consecutive wrong symbols on the
+// channel then puts at most t wrong symbols into any one codeword,
+// within what DecodeErrors can correct if t <= (n-k)/2.
+//
+//	words := append(append(word0, word1...), word2...)
+//	sent := NewInterleaver(3).Interleave(words)
+//	...
+//	words = NewInterleaver(3).Deinterleave(received)
+//	data0, err := DecodeErrors(words[:n], k)
+type Interleaver struct {
+	depth int
+}
+
+// NewInterleaver returns the Interleaver for depth codewords at a
+// time.  depth must be at least 1, depth 1 leaves the symbols as they
+// are.
+func NewInterleaver(depth int) *Interleaver {
+	if depth < 1 {
+		fail(fmt.Errorf("Invalid interleaving depth %d", depth))
+		return nil
+	}
+	return &Interleaver{depth}
+}
+
+// Depth returns the number of codewords interleaved.
+func (p *Interleaver) Depth() int {
+	return p.depth
+}
+
+// Interleave returns the Depth() codewords of equal length in in[],
+// back to back, interleaved symbol by symbol.  len(in) must be a
+// multiple of Depth().
+func (p *Interleaver) Interleave(in []uint8) []uint8 {
+	if err := p.lengthError(in); err != nil {
+		fail(err)
+		return nil
+	}
+	n := len(in) / p.depth
+	out := make([]uint8, len(in))
+	for c := 0; c < p.depth; c++ {
+		for j, v := range in[c*n : (c+1)*n] {
+			out[j*p.depth+c] = v
+		}
+	}
+	return out
+}
+
+// Deinterleave undoes Interleave, returning the Depth() codewords in
+// in[] back to back.  len(in) must be a multiple of Depth().
+func (p *Interleaver) Deinterleave(in []uint8) []uint8 {
+	if err := p.lengthError(in); err != nil {
+		fail(err)
+		return nil
+	}
+	n := len(in) / p.depth
+	out := make([]uint8, len(in))
+	for c := 0; c < p.depth; c++ {
+		for j := range out[c*n : (c+1)*n] {
+			out[c*n+j] = in[j*p.depth+c]
+		}
+	}
+	return out
+}
+
+func (p *Interleaver) lengthError(in []uint8) error {
+	if len(in)%p.depth != 0 {
+		return fmt.Errorf("Length %d is not a multiple of the interleaving depth %d", len(in), p.depth)
+	}
+	return nil
+}
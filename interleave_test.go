@@ -0,0 +1,79 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestInterleave(t *testing.T) {
+	il := NewInterleaver(3)
+	in := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	want := []byte{1, 5, 9, 2, 6, 10, 3, 7, 11, 4, 8, 12}
+	out := il.Interleave(in)
+	if !bytes.Equal(out, want) {
+		t.Error("Interleave = ", out)
+	}
+	if back := il.Deinterleave(out); !bytes.Equal(back, in) {
+		t.Error("Deinterleave = ", back)
+	}
+	if out := NewInterleaver(1).Interleave(in); !bytes.Equal(out, in) {
+		t.Error("depth 1 changed the symbols: ", out)
+	}
+	if out := il.Interleave(nil); len(out) != 0 {
+		t.Error("Interleave(nil) = ", out)
+	}
+}
+
+// A burst of depth*t wrong symbols leaves t in each codeword.
+func TestInterleaveBurst(t *testing.T) {
+	const k, n, depth = 10, 16, 5
+	rnd := rand.New(rand.NewSource(1))
+	coder := NewVandermondeCoder(k, n-k)
+	il := NewInterleaver(depth)
+	var data [][]byte
+	var words []byte
+	for c := 0; c < depth; c++ {
+		d, w := codeword(rnd, coder)
+		data = append(data, d)
+		words = append(words, w...)
+	}
+	sent := il.Interleave(words)
+	burst := depth * (n - k) / 2
+	for j := 17; j < 17+burst; j++ {
+		sent[j] ^= byte(1 + rnd.Intn(255))
+	}
+	received := il.Deinterleave(sent)
+	for c := 0; c < depth; c++ {
+		got, err := DecodeErrors(received[c*n:(c+1)*n], k)
+		if err != nil || !bytes.Equal(got, data[c]) {
+			t.Errorf("codeword %d: %v, %v != %v", c, err, got, data[c])
+		}
+	}
+}
+
+func TestNewInterleaverPanicOnBadDepth(t *testing.T) {
+	defer recoverExpected(t)
+	NewInterleaver(0) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestInterleavePanicOnBadLength(t *testing.T) {
+	defer recoverExpected(t)
+	NewInterleaver(3).Interleave(make([]byte, 10)) // should panic
+	t.Error("Failed to panic")
+}
@@ -0,0 +1,120 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// The binary form of an ErasureCoder, for storing the exact coder used
+// to encode an archive alongside it, is
+//
+//	"RSEC"      4 bytes magic
+//	version     1 byte, 1
+//	kind        1 byte, 0 for abscissae, 1 for a matrix
+//	strategy    1 byte
+//	polynomial  2 bytes, big endian, of the field
+//	degree      2 bytes, big endian
+//	outputs     2 bytes, big endian
+//
+// followed for kind 0 by the degree in_x and the outputs out_x, and
+// for kind 1, a coder constructed from a matrix, by the Matrix() row
+// by row.
+const (
+	marshalHeaderLen = 13
+	marshalVersion   = 1
+	kindAbscissae    = 0
+	kindMatrix       = 1
+)
+
+var marshalMagic = []byte("RSEC")
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (p *ErasureCoder) MarshalBinary() ([]byte, error) {
+	b := make([]byte, marshalHeaderLen)
+	copy(b, marshalMagic)
+	b[4] = marshalVersion
+	b[6] = uint8(p.strategy)
+	binary.BigEndian.PutUint16(b[7:], p.field.Polynomial())
+	binary.BigEndian.PutUint16(b[9:], uint16(p.Degree()))
+	binary.BigEndian.PutUint16(b[11:], uint16(p.NumOutputs()))
+	if p.in_x != nil {
+		b[5] = kindAbscissae
+		b = append(b, p.in_x...)
+		b = append(b, p.out_x...)
+	} else {
+		b[5] = kindMatrix
+		for _, row := range p.interp {
+			b = append(b, row...)
+		}
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.  It replaces
+// the receiver, which must not be in use, with the coder data[] was
+// marshaled from.
+func (p *ErasureCoder) UnmarshalBinary(data []byte) error {
+	if len(data) < marshalHeaderLen || string(data[:4]) != string(marshalMagic) {
+		return fmt.Errorf("Not a marshaled ErasureCoder")
+	}
+	if data[4] != marshalVersion {
+		return fmt.Errorf("Unsupported ErasureCoder version %d", data[4])
+	}
+	kind, strategy := data[5], Strategy(data[6])
+	if strategy > NoTables {
+		return fmt.Errorf("Unknown strategy %v", strategy)
+	}
+	field := defaultField
+	if poly := binary.BigEndian.Uint16(data[7:]); poly != field.Polynomial() {
+		var err error
+		if field, err = NewField(poly); err != nil {
+			return err
+		}
+	}
+	degree := int(binary.BigEndian.Uint16(data[9:]))
+	outputs := int(binary.BigEndian.Uint16(data[11:]))
+	body := data[marshalHeaderLen:]
+
+	var q *ErasureCoder
+	switch kind {
+	case kindAbscissae:
+		if len(body) != degree+outputs {
+			return fmt.Errorf("Wrong length of marshaled ErasureCoder: %d bytes for %d abscissae", len(body), degree+outputs)
+		}
+		in_x, out_x := body[:degree], body[degree:]
+		if err := coderAbscissaeError(in_x, out_x); err != nil {
+			return err
+		}
+		q = NewErasureCoderField(field, in_x, out_x)
+	case kindMatrix:
+		if degree == 0 || len(body) != degree*outputs {
+			return fmt.Errorf("Wrong length of marshaled ErasureCoder: %d bytes for a %dx%d matrix", len(body), degree, outputs)
+		}
+		interp := makeMatrix(degree, outputs)
+		for i := range interp {
+			copy(interp[i], body[i*outputs:])
+		}
+		q = newCoder(field, interp)
+	default:
+		return fmt.Errorf("Unknown kind of marshaled ErasureCoder %d", kind)
+	}
+	if q.strategy != strategy {
+		q.setStrategy(strategy)
+	}
+	*p = *q
+	return nil
+}
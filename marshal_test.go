@@ -0,0 +1,73 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	f, _ := NewField(0x12D)
+	for _, c := range []*ErasureCoder{
+		NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4}),
+		NewErasureCoderField(f, []byte{10, 20}, []byte{30, 40, 50}),
+		NewCauchyCoder(3, 2),
+		NewErasureCoder([]byte{5, 6}, []byte{7}).WithStrategy(NoTables),
+	} {
+		b, err := c.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := new(ErasureCoder)
+		if err := d.UnmarshalBinary(b); err != nil {
+			t.Fatalf("%v: %v", c, err)
+		}
+		if d.String() != c.String() || d.GoString() != c.GoString() || d.Strategy() != c.Strategy() {
+			t.Errorf("got %v %v, want %v %v", d, d.Strategy(), c, c.Strategy())
+		}
+		in := randomMatrix(c.Degree(), 20, 1)
+		want, got := c.Code(in), d.Code(in)
+		for k := range want {
+			if !bytes.Equal(got[k], want[k]) {
+				t.Errorf("%v: output %d differs after unmarshaling", c, k)
+			}
+		}
+	}
+}
+
+func TestUnmarshalBinaryRejectsBadData(t *testing.T) {
+	good, _ := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4}).MarshalBinary()
+	corrupt := func(i int, v byte) []byte {
+		b := append([]byte(nil), good...)
+		b[i] = v
+		return b
+	}
+	for _, b := range [][]byte{
+		nil,
+		good[:len(good)-1],
+		corrupt(0, 'X'),         // magic
+		corrupt(4, 2),           // version
+		corrupt(5, 7),           // kind
+		corrupt(6, 9),           // strategy
+		corrupt(8, 0x1c),        // reducible polynomial 0x11c
+		corrupt(len(good)-1, 3), // duplicate out_x
+	} {
+		var c ErasureCoder
+		if err := c.UnmarshalBinary(b); err == nil {
+			t.Errorf("UnmarshalBinary(%x) accepted", b)
+		}
+	}
+}
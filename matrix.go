@@ -0,0 +1,128 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import "fmt"
+
+// Return the transpose of the X x Y matrix m.
+func transpose(m [][]uint8) [][]uint8 {
+	if len(m) == 0 {
+		return nil
+	}
+	t := makeMatrix(len(m[0]), len(m))
+	for i, row := range m {
+		for j, v := range row {
+			t[j][i] = v
+		}
+	}
+	return t
+}
+
+// Invert returns the inverse of the square matrix m over GF(2^8), or
+// an error if m is singular or not square.  m is not modified.  An
+// error for the rows of the generator matrix of a set of shards means
+// those shards don't determine the data, so it can be used to check a
+// subset before attempting to decode from it.
+func Invert(m [][]uint8) ([][]uint8, error) {
+	return invertMatrix(defaultField, m)
+}
+
+// Invert is like the package function Invert, but over f.
+func (f *Field) Invert(m [][]uint8) ([][]uint8, error) {
+	return invertMatrix(f, m)
+}
+
+// Recoverable reports whether the outputs of p at the indices wanted
+// can be computed from those at the indices present, i.e. whether the
+// rows of the encoding matrix of the first Degree() present outputs,
+// those a decoder would use, are invertible.  It is an error if fewer
+// than Degree() are present, or if an index is repeated or not that
+// of an output.
+//
+// For a coder constructed from abscissae, any Degree() distinct
+// outputs determine the polynomial, so the answer is always true, and
+// the same holds for the rows of a Cauchy matrix like that of
+// NewCauchyCoder.  Only a coder from an arbitrary matrix, see
+// CoderFromMatrix, can have present outputs that don't suffice.
+func (p *ErasureCoder) Recoverable(present, wanted []uint8) (bool, error) {
+	if len(present) < p.Degree() {
+		return false, fmt.Errorf("Only %d of %d outputs present", len(present), p.Degree())
+	}
+	if err := abscissaeError("present", present); err != nil {
+		return false, err
+	}
+	if err := abscissaeError("wanted", wanted); err != nil {
+		return false, err
+	}
+	for _, k := range append(append([]uint8(nil), present...), wanted...) {
+		if int(k) >= p.NumOutputs() {
+			return false, fmt.Errorf("Output index %d out of range for %d outputs", k, p.NumOutputs())
+		}
+	}
+	if p.out_x != nil {
+		return true, nil
+	}
+
+	enc := p.EncodingMatrix()
+	rows := make([][]uint8, p.Degree())
+	for j := range rows {
+		rows[j] = enc[present[j]]
+	}
+	_, err := p.field.Invert(rows)
+	return err == nil, nil
+}
+
+// Return the inverse of the square matrix m over fld by Gauss-Jordan
+// elimination, or an error if it is singular.  m is not modified.
+func invertMatrix(fld *Field, m [][]uint8) ([][]uint8, error) {
+	n := len(m)
+	a := makeMatrix(n, n)
+	r := makeMatrix(n, n)
+	for i := range m {
+		if len(m[i]) != n {
+			return nil, fmt.Errorf("Matrix is not square: row %d has %d columns, want %d", i, len(m[i]), n)
+		}
+		copy(a[i], m[i])
+		r[i][i] = 1
+	}
+
+	for c := 0; c < n; c++ {
+		pivot := c
+		for pivot < n && a[pivot][c] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, fmt.Errorf("Matrix is singular")
+		}
+		a[c], a[pivot] = a[pivot], a[c]
+		r[c], r[pivot] = r[pivot], r[c]
+
+		if f := a[c][c]; f != 1 {
+			for j := 0; j < n; j++ {
+				a[c][j] = fld.Div(a[c][j], f)
+				r[c][j] = fld.Div(r[c][j], f)
+			}
+		}
+		for i := 0; i < n; i++ {
+			if f := a[i][c]; i != c && f != 0 {
+				for j := 0; j < n; j++ {
+					a[i][j] ^= fld.Mul(f, a[c][j])
+					r[i][j] ^= fld.Mul(f, r[c][j])
+				}
+			}
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestInvertMatrix(t *testing.T) {
+	// The encoding matrix of the inputs at 3, 4, 5 is invertible, and
+	// its inverse is the one of the decoder back.
+	enc := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4, 5}).EncodingMatrix()
+	dec := NewErasureCoder([]byte{3, 4, 5}, []byte{0, 1, 2}).EncodingMatrix()
+	inv, err := invertMatrix(defaultField, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range inv {
+		if !bytes.Equal(inv[i], dec[i]) {
+			t.Errorf("row %d: %v != %v", i, inv[i], dec[i])
+		}
+	}
+
+	if _, err := invertMatrix(defaultField, [][]byte{{1, 2}, {2, 4}}); err == nil {
+		t.Error("invertMatrix inverted a singular matrix")
+	}
+	if _, err := invertMatrix(defaultField, [][]byte{{1, 2}}); err == nil {
+		t.Error("invertMatrix inverted a non-square matrix")
+	}
+}
+
+func TestInvert(t *testing.T) {
+	f, _ := NewField(0x12D)
+	for _, fld := range []*Field{defaultField, f} {
+		m := randomMatrix(6, 6, 4)
+		inv, err := fld.Invert(m)
+		if err != nil {
+			t.Fatal(err) // the odds of a random singular matrix are small, and the seed is fixed
+		}
+		for i := range m {
+			for j := range m {
+				var v uint8
+				for l := range m {
+					v ^= fld.Mul(m[i][l], inv[l][j])
+				}
+				if (i == j) != (v == 1) || (i != j && v != 0) {
+					t.Fatalf("%v: m * inverse is not the identity at %d,%d: %d", fld, i, j, v)
+				}
+			}
+		}
+	}
+
+	// The rows of any 3 shards of a Cauchy code are invertible, those
+	// of a shard twice are not.
+	gen := NewCauchyCoder(3, 2).EncodingMatrix()
+	if _, err := Invert([][]byte{gen[0], gen[3], gen[4]}); err != nil {
+		t.Error(err)
+	}
+	if _, err := Invert([][]byte{gen[0], gen[3], gen[3]}); err == nil {
+		t.Error("Invert inverted a singular matrix")
+	}
+}
+
+func TestRecoverable(t *testing.T) {
+	// Outputs 2 and 3 are multiples of each other.
+	c := CoderFromMatrix([][]byte{{1, 0, 1, 2}, {0, 1, 1, 2}})
+	for _, r := range []struct {
+		present, wanted []byte
+		ok              bool
+	}{
+		{[]byte{0, 1}, []byte{2, 3}, true},
+		{[]byte{0, 2}, []byte{1}, true},
+		{[]byte{2, 3}, []byte{0}, false},
+		{[]byte{2, 3, 0}, []byte{1}, false}, // only the first two count
+	} {
+		if ok, err := c.Recoverable(r.present, r.wanted); ok != r.ok || err != nil {
+			t.Errorf("Recoverable(%v, %v) = %v, %v", r.present, r.wanted, ok, err)
+		}
+	}
+	for _, present := range [][]byte{{0}, {0, 0}, {0, 4}} {
+		if _, err := c.Recoverable(present, []byte{1}); err == nil {
+			t.Error("Recoverable accepted present ", present)
+		}
+	}
+
+	cauchy := NewCauchyCoder(3, 3)
+	forSubsets(6, 3, func(s []int) bool {
+		present := []byte{byte(s[0]), byte(s[1]), byte(s[2])}
+		if ok, err := cauchy.Recoverable(present, []byte{0, 1, 2}); !ok || err != nil {
+			t.Errorf("Cauchy outputs %v: %v, %v", present, ok, err)
+		}
+		return true
+	})
+	if ok, err := NewVandermondeCoder(3, 2).Recoverable([]byte{4, 1, 3}, []byte{0}); !ok || err != nil {
+		t.Error("Vandermonde coder: ", ok, err)
+	}
+}
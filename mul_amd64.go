@@ -0,0 +1,106 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build amd64 && !purego
+
+package rs
+
+// Multiplication by a constant c splits over the nibbles of a byte,
+// c*b = c*(b&0xf0) ^ c*(b&0x0f), so with two 16 byte tables of the
+// products of c with all low and all high nibbles, PSHUFB looks up 16
+// (SSSE3) or 32 (AVX2) products per instruction.
+
+// Set at init from CPUID, and cleared by tests to cover the fallbacks.
+var useSSSE3, useAVX2 = cpuFeatures()
+
+func cpuid(eax, ecx uint32) (a, b, c, d uint32)
+func xgetbv() (eax, edx uint32)
+
+// Xor src[] multiplied by the constant with nibble product tables
+// nib[0:16] and nib[16:32] into dst[].  len(src) must be a multiple of
+// 16, or for the AVX2 version 32, and dst[] at least as long.
+//
+//go:noescape
+func mulAddNibblesSSSE3(nib *[32]uint8, dst, src []uint8)
+
+//go:noescape
+func mulAddNibblesAVX2(nib *[32]uint8, dst, src []uint8)
+
+func cpuFeatures() (ssse3, avx2 bool) {
+	max, _, _, _ := cpuid(0, 0)
+	if max < 1 {
+		return false, false
+	}
+	_, _, c, _ := cpuid(1, 0)
+	ssse3 = c&(1<<9) != 0
+	osxsave := c&(1<<27) != 0
+	if max < 7 || !osxsave {
+		return ssse3, false
+	}
+	// The OS must save the XMM and YMM state.
+	if xcr0, _ := xgetbv(); xcr0&6 != 6 {
+		return ssse3, false
+	}
+	_, b, _, _ := cpuid(7, 0)
+	return ssse3, b&(1<<5) != 0
+}
+
+// Each kernel has a fixed cost per call, so which is fastest depends
+// on the length; see BenchmarkMulAddKernels.  The SSSE3 kernel must
+// first gather the nibble tables, which the generic loop beats on
+// blocks of up to a few dozen bytes.  The AVX2 kernel costs some 200ns
+// per call on the machine measured, presumably the upper halves of the
+// vector units powering up for the first 256 bit instruction, so it
+// only pays on blocks of a few KB.
+const (
+	ssse3MinLen = 64
+	avx2MinLen  = 4 << 10
+)
+
+// KernelFor returns the name of the kernel that multiplies blocks of
+// blockLen bytes on this machine: "avx2", "ssse3" or "generic".  The
+// tails of blocks that aren't a multiple of the vector width are done
+// by the narrower kernels.
+func KernelFor(blockLen int) string {
+	switch {
+	case blockLen >= avx2MinLen && useAVX2:
+		return "avx2"
+	case blockLen >= ssse3MinLen && useSSSE3:
+		return "ssse3"
+	}
+	return "generic"
+}
+
+// Xor src[] multiplied by the constant whose product table is tbl into
+// dst[], which must be at least as long as src[].
+func mulAddTable(dst, src []uint8, tbl *[256]uint8) {
+	dst = dst[:len(src)]
+	if n := len(src) &^ 15; len(src) >= ssse3MinLen && useSSSE3 {
+		var nib [32]uint8
+		for j := 0; j < 16; j++ {
+			nib[j] = tbl[j]
+			nib[16+j] = tbl[j<<4]
+		}
+		if n32 := len(src) &^ 31; len(src) >= avx2MinLen && useAVX2 {
+			mulAddNibblesAVX2(&nib, dst[:n32], src[:n32])
+			dst, src = dst[n32:], src[n32:]
+			n = len(src) &^ 15
+		}
+		if n > 0 {
+			mulAddNibblesSSSE3(&nib, dst[:n], src[:n])
+			dst, src = dst[n:], src[n:]
+		}
+	}
+	mulAddTableGeneric(dst, src, tbl)
+}
@@ -0,0 +1,107 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build amd64 && !purego
+
+#include "textflag.h"
+
+// func cpuid(eax, ecx uint32) (a, b, c, d uint32)
+TEXT ·cpuid(SB), NOSPLIT, $0-24
+	MOVL eax+0(FP), AX
+	MOVL ecx+4(FP), CX
+	CPUID
+	MOVL AX, a+8(FP)
+	MOVL BX, b+12(FP)
+	MOVL CX, c+16(FP)
+	MOVL DX, d+20(FP)
+	RET
+
+// func xgetbv() (eax, edx uint32)
+TEXT ·xgetbv(SB), NOSPLIT, $0-8
+	MOVL $0, CX
+	XGETBV
+	MOVL AX, eax+0(FP)
+	MOVL DX, edx+4(FP)
+	RET
+
+// func mulAddNibblesSSSE3(nib *[32]uint8, dst, src []uint8)
+TEXT ·mulAddNibblesSSSE3(SB), NOSPLIT, $0-56
+	MOVQ nib+0(FP), AX
+	MOVQ dst_base+8(FP), DI
+	MOVQ src_base+32(FP), SI
+	MOVQ src_len+40(FP), CX
+	SHRQ $4, CX
+	JZ   ssse3_done
+
+	MOVOU (AX), X6   // products with the low nibbles
+	MOVOU 16(AX), X7 // products with the high nibbles
+	MOVL  $0x0f0f0f0f, DX
+	MOVL  DX, X8
+	PSHUFD $0, X8, X8
+
+ssse3_loop:
+	MOVOU (SI), X0
+	MOVOU X0, X1
+	PSRLQ $4, X1
+	PAND  X8, X0
+	PAND  X8, X1
+	MOVOU X6, X2
+	MOVOU X7, X3
+	PSHUFB X0, X2
+	PSHUFB X1, X3
+	PXOR  X2, X3
+	MOVOU (DI), X4
+	PXOR  X3, X4
+	MOVOU X4, (DI)
+	ADDQ  $16, SI
+	ADDQ  $16, DI
+	DECQ  CX
+	JNZ   ssse3_loop
+
+ssse3_done:
+	RET
+
+// func mulAddNibblesAVX2(nib *[32]uint8, dst, src []uint8)
+TEXT ·mulAddNibblesAVX2(SB), NOSPLIT, $0-56
+	MOVQ nib+0(FP), AX
+	MOVQ dst_base+8(FP), DI
+	MOVQ src_base+32(FP), SI
+	MOVQ src_len+40(FP), CX
+	SHRQ $5, CX
+	JZ   avx2_done
+
+	VBROADCASTI128 (AX), Y6   // products with the low nibbles
+	VBROADCASTI128 16(AX), Y7 // products with the high nibbles
+	MOVL $0x0f0f0f0f, DX
+	MOVL DX, X8
+	VPBROADCASTD X8, Y8
+
+avx2_loop:
+	VMOVDQU (SI), Y0
+	VPSRLQ  $4, Y0, Y1
+	VPAND   Y8, Y0, Y0
+	VPAND   Y8, Y1, Y1
+	VPSHUFB Y0, Y6, Y2
+	VPSHUFB Y1, Y7, Y3
+	VPXOR   Y2, Y3, Y3
+	VPXOR   (DI), Y3, Y3
+	VMOVDQU Y3, (DI)
+	ADDQ    $32, SI
+	ADDQ    $32, DI
+	DECQ    CX
+	JNZ     avx2_loop
+	VZEROUPPER
+
+avx2_done:
+	RET
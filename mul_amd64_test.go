@@ -0,0 +1,145 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build amd64 && !purego
+
+package rs
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// Run f with each combination of the CPU features the machine has.
+func forCPUFeatures(f func(name string)) {
+	ssse3, avx2 := useSSSE3, useAVX2
+	defer func() { useSSSE3, useAVX2 = ssse3, avx2 }()
+	for _, c := range []struct {
+		name        string
+		ssse3, avx2 bool
+	}{{"generic", false, false}, {"ssse3", true, false}, {"avx2", true, true}} {
+		if c.ssse3 && !ssse3 || c.avx2 && !avx2 {
+			continue
+		}
+		useSSSE3, useAVX2 = c.ssse3, c.avx2
+		f(c.name)
+	}
+}
+
+func TestKernelFor(t *testing.T) {
+	forCPUFeatures(func(name string) {
+		for _, c := range []struct {
+			n    int
+			want string
+		}{
+			{0, "generic"},
+			{ssse3MinLen - 1, "generic"},
+			{ssse3MinLen, "ssse3"},
+			{avx2MinLen - 1, "ssse3"},
+			{avx2MinLen, "avx2"},
+		} {
+			want := c.want
+			if want == "avx2" && !useAVX2 {
+				want = "ssse3"
+			}
+			if want == "ssse3" && !useSSSE3 {
+				want = "generic"
+			}
+			if got := KernelFor(c.n); got != want {
+				t.Errorf("%s: KernelFor(%d) = %s, want %s", name, c.n, got, want)
+			}
+		}
+	})
+}
+
+func TestMulAddTableSIMD(t *testing.T) {
+	t.Logf("SSSE3 %v, AVX2 %v", useSSSE3, useAVX2)
+	src := randomMatrix(1, avx2MinLen+100, 3)[0]
+	// All short lengths, and some around the switch to AVX2.
+	var lens []int
+	for n := 0; n <= 200; n += 1 + n/8 {
+		lens = append(lens, n)
+	}
+	for _, d := range []int{-1, 0, 1, 15, 31, 32, 33, 63, 100} {
+		lens = append(lens, avx2MinLen+d)
+	}
+	forCPUFeatures(func(name string) {
+		var tbl [256]byte
+		for _, c := range []byte{0, 1, 2, 0x8e, 0xff} {
+			mulTable(c, &tbl)
+			for _, n := range lens {
+				want := randomMatrix(1, n+1, 4)[0]
+				got := append([]byte(nil), want...)
+				mulAddTableGeneric(want, src[:n], &tbl)
+				mulAddTable(got, src[:n], &tbl)
+				if !bytes.Equal(got, want) {
+					t.Fatalf("%s: c = %d, n = %d: differs from generic", name, c, n)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkMulAddSIMD(b *testing.B) {
+	const n = 128 << 10
+	src, dst := randomMatrix(1, n, 1)[0], make([]byte, n)
+	var tbl [256]byte
+	mulTable(0x8e, &tbl)
+	forCPUFeatures(func(name string) {
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(n)
+			for i := 0; i < b.N; i++ {
+				mulAddTable(dst, src, &tbl)
+			}
+		})
+	})
+}
+
+// The kernels by themselves, without mulAddTable's choice by length,
+// to find the lengths from which each one pays.
+func BenchmarkMulAddKernels(b *testing.B) {
+	var tbl [256]byte
+	mulTable(0x8e, &tbl)
+	var nib [32]uint8
+	for j := 0; j < 16; j++ {
+		nib[j] = tbl[j]
+		nib[16+j] = tbl[j<<4]
+	}
+	for _, n := range []int{32, 64, 256, 1 << 10, 2 << 10, 4 << 10, 16 << 10, 128 << 10} {
+		src, dst := randomMatrix(1, n, 1)[0], make([]byte, n)
+		b.Run(fmt.Sprintf("generic/%d", n), func(b *testing.B) {
+			b.SetBytes(int64(n))
+			for i := 0; i < b.N; i++ {
+				mulAddTableGeneric(dst, src, &tbl)
+			}
+		})
+		if useSSSE3 {
+			b.Run(fmt.Sprintf("ssse3/%d", n), func(b *testing.B) {
+				b.SetBytes(int64(n))
+				for i := 0; i < b.N; i++ {
+					mulAddNibblesSSSE3(&nib, dst, src)
+				}
+			})
+		}
+		if useAVX2 {
+			b.Run(fmt.Sprintf("avx2/%d", n), func(b *testing.B) {
+				b.SetBytes(int64(n))
+				for i := 0; i < b.N; i++ {
+					mulAddNibblesAVX2(&nib, dst, src)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !amd64 || purego
+
+package rs
+
+// KernelFor returns the name of the kernel that multiplies blocks of
+// blockLen bytes on this machine, which without SIMD kernels is always
+// "generic".
+func KernelFor(blockLen int) string {
+	return "generic"
+}
+
+// Xor src[] multiplied by the constant whose product table is tbl into
+// dst[], which must be at least as long as src[].
+func mulAddTable(dst, src []uint8, tbl *[256]uint8) {
+	mulAddTableGeneric(dst, src, tbl)
+}
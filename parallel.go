@@ -0,0 +1,107 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"runtime"
+	"sync"
+)
+
+// CodeByOutput is like Code, but computes the outputs concurrently on
+// up to workers goroutines, each of which computes entire output rows.
+// Since no two goroutines write to the same row, they don't contend
+// for cache lines.  If workers <= 0, runtime.GOMAXPROCS(0) is used.
+// Parallelism is limited by the number of outputs.
+func (p *ErasureCoder) CodeByOutput(in [][]uint8, workers int) (out [][]uint8) {
+	if err := p.inputError(in); err != nil {
+		fail(err)
+		return nil
+	}
+	out = makeMatrix(len(p.interp[0]), blockSize(in))
+
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(out) {
+		workers = len(out)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for k := w; k < len(out); k += workers {
+				for i := range in {
+					if c := p.interp[i][k]; c != 0 && len(in[i]) > 0 {
+						p.mulAdd(out[k], in[i], i, k)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	return
+}
+
+// CodeParallel is like Code, but splits the columns into up to workers
+// contiguous ranges and computes them concurrently.  Each goroutine
+// writes only its own columns, so no locking is needed; ranges are
+// multiples of 64 bytes so they don't share cache lines either.  If
+// workers <= 0, runtime.GOMAXPROCS(0) is used.  Only worth it for large
+// blocks, see BenchmarkParallel.
+func (p *ErasureCoder) CodeParallel(in [][]uint8, workers int) (out [][]uint8) {
+	if err := p.inputError(in); err != nil {
+		fail(err)
+		return nil
+	}
+	n := blockSize(in)
+	out = makeMatrix(len(p.interp[0]), n)
+
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	const align = 64
+	chunk := (n + workers - 1) / workers
+	chunk = (chunk + align - 1) / align * align
+	if chunk == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for lo := 0; lo < n; lo += chunk {
+		hi := lo + chunk
+		if hi > n {
+			hi = n
+		}
+		sub_in := make([][]uint8, len(in))
+		for i := range in {
+			if in[i] != nil {
+				sub_in[i] = in[i][lo:hi]
+			}
+		}
+		sub_out := make([][]uint8, len(out))
+		for k := range out {
+			sub_out[k] = out[k][lo:hi]
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.code(sub_in, sub_out)
+		}()
+	}
+	wg.Wait()
+	return
+}
@@ -0,0 +1,96 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func randomMatrix(x, y int, seed byte) [][]byte {
+	m := makeMatrix(x, y)
+	for i := range m {
+		for j := range m[i] {
+			seed = seed*167 + 13
+			m[i][j] = seed
+		}
+	}
+	return m
+}
+
+func TestCodeByOutput(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2, 3}, []byte{4, 5, 6, 7, 8})
+	in := randomMatrix(4, 1000, 1)
+	want := c.Code(in)
+	for _, w := range []int{0, 1, 2, 5, 17} {
+		got := c.CodeByOutput(in, w)
+		for k := range want {
+			if !bytes.Equal(got[k], want[k]) {
+				t.Errorf("%d workers: output %d differs", w, k)
+			}
+		}
+	}
+}
+
+func TestCodeParallel(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2, 3}, []byte{4, 5, 6, 7, 8})
+	for _, n := range []int{0, 1, 63, 64, 1000, 4097} {
+		in := randomMatrix(4, n, 1)
+		in[2] = nil
+		want := c.Code(in)
+		for _, w := range []int{0, 1, 2, 3, 17} {
+			got := c.CodeParallel(in, w)
+			for k := range want {
+				if !bytes.Equal(got[k], want[k]) {
+					t.Errorf("%d bytes, %d workers: output %d differs", n, w, k)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkParallel(b *testing.B) {
+	for _, s := range []struct{ k, m, n int }{{4, 2, 4 << 20}, {10, 4, 4 << 20}, {10, 14, 1 << 20}} {
+		in_x, out_x := make([]byte, s.k), make([]byte, s.m)
+		for i := range in_x {
+			in_x[i] = byte(i)
+		}
+		for i := range out_x {
+			out_x[i] = byte(s.k + i)
+		}
+		c := NewErasureCoder(in_x, out_x)
+		in := randomMatrix(s.k, s.n, 1)
+
+		b.Run(fmt.Sprintf("serial/%dx%dx%d", s.k, s.m, s.n), func(b *testing.B) {
+			b.SetBytes(int64(s.k * s.n))
+			for i := 0; i < b.N; i++ {
+				c.Code(in)
+			}
+		})
+		b.Run(fmt.Sprintf("byoutput/%dx%dx%d", s.k, s.m, s.n), func(b *testing.B) {
+			b.SetBytes(int64(s.k * s.n))
+			for i := 0; i < b.N; i++ {
+				c.CodeByOutput(in, 0)
+			}
+		})
+		b.Run(fmt.Sprintf("bycolumn/%dx%dx%d", s.k, s.m, s.n), func(b *testing.B) {
+			b.SetBytes(int64(s.k * s.n))
+			for i := 0; i < b.N; i++ {
+				c.CodeParallel(in, 0)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import "fmt"
+
+// ReconstructFetch computes the shards at abscissae want_x of a code of
+// the given degree, preferring the shards have[] at abscissae have_x
+// that are already in memory, and calling fetch for as few of the
+// candidates[] abscissae as needed to make up degree survivors.
+// Candidates are tried in order; one for which fetch fails is treated
+// as lost and the next one is tried.  Candidates in have_x are skipped.
+func ReconstructFetch(degree int, have_x []uint8, have [][]uint8, candidates []uint8, fetch func(x uint8) ([]uint8, error), want_x []uint8) ([][]uint8, error) {
+	if len(have_x) != len(have) {
+		return nil, fmt.Errorf("Wrong number of shards: %d for %d abscissae", len(have), len(have_x))
+	}
+	if degree < 1 {
+		return nil, fmt.Errorf("Invalid degree %d", degree)
+	}
+	if err := abscissaeError("want_x", want_x); err != nil {
+		return nil, err
+	}
+
+	var used_x []uint8
+	var used [][]uint8
+	var in_use [256]bool
+	for i, x := range have_x {
+		if len(used) == degree {
+			break
+		}
+		if !in_use[x] {
+			in_use[x] = true
+			used_x = append(used_x, x)
+			used = append(used, have[i])
+		}
+	}
+
+	var last_err error
+	for _, x := range candidates {
+		if len(used) == degree {
+			break
+		}
+		if in_use[x] {
+			continue
+		}
+		in_use[x] = true
+		b, err := fetch(x)
+		if err != nil {
+			last_err = err
+			continue
+		}
+		used_x = append(used_x, x)
+		used = append(used, b)
+	}
+
+	if len(used) < degree {
+		if last_err != nil {
+			return nil, fmt.Errorf("Only %d of %d shards available, last fetch error: %v", len(used), degree, last_err)
+		}
+		return nil, fmt.Errorf("Only %d of %d shards available", len(used), degree)
+	}
+
+	c := NewErasureCoder(used_x, want_x)
+	if err := c.inputError(used); err != nil {
+		return nil, err
+	}
+	return c.Code(used), nil
+}
+
+// A Reconstructor recovers lost shards of a code of a fixed degree over
+// a fixed set of abscissae, so that the caller only has to say which
+// shards are present and which are wanted, rather than constructing
+// the right ErasureCoder by hand.  It is immutable and safe for
+// concurrent use.
+type Reconstructor struct {
+	degree int
+	member [256]bool
+	coders *Registry // if not nil, caches the coders
+}
+
+// NewReconstructor returns a Reconstructor for a code of the given
+// degree whose shards are at the distinct abscissae all_x.
+func NewReconstructor(degree int, all_x []uint8) (*Reconstructor, error) {
+	if degree < 1 || degree > len(all_x) {
+		return nil, fmt.Errorf("Invalid degree %d for %d shards", degree, len(all_x))
+	}
+	if err := abscissaeError("all_x", all_x); err != nil {
+		return nil, err
+	}
+	r := &Reconstructor{degree: degree}
+	for _, x := range all_x {
+		r.member[x] = true
+	}
+	return r, nil
+}
+
+// Coder returns the ErasureCoder that computes the shards at want_x
+// from the first Degree() of the shards at present_x.  It is an error
+// if fewer than that are present, or if any abscissa isn't one of the
+// code's.
+func (r *Reconstructor) Coder(present_x, want_x []uint8) (*ErasureCoder, error) {
+	if err := r.check(present_x, want_x); err != nil {
+		return nil, err
+	}
+	return r.coder(present_x[:r.degree], want_x), nil
+}
+
+// Construct, or get from the cache, the coder for in_x and out_x.
+func (r *Reconstructor) coder(in_x, out_x []uint8) *ErasureCoder {
+	if r.coders != nil {
+		return r.coders.GetOrCreate(in_x, out_x)
+	}
+	return NewErasureCoder(in_x, out_x)
+}
+
+// Check the arguments of Coder.
+func (r *Reconstructor) check(present_x, want_x []uint8) error {
+	if len(present_x) < r.degree {
+		return fmt.Errorf("Only %d of %d shards present", len(present_x), r.degree)
+	}
+	if err := abscissaeError("present_x", present_x); err != nil {
+		return err
+	}
+	if err := abscissaeError("want_x", want_x); err != nil {
+		return err
+	}
+	for _, x := range present_x {
+		if !r.member[x] {
+			return fmt.Errorf("Present abscissa %d is not in the code", x)
+		}
+	}
+	for _, x := range want_x {
+		if !r.member[x] {
+			return fmt.Errorf("Wanted abscissa %d is not in the code", x)
+		}
+	}
+	return nil
+}
+
+// Reconstruct returns the shards at want_x computed from the shards
+// present[] at present_x.  Shards beyond the first Degree() are not
+// used for computing.  Wanted shards that are present are not computed
+// at all: the returned out[j] is then present[i] itself, not a copy, so
+// that reading the data shards of an intact stripe costs nothing.
+func (r *Reconstructor) Reconstruct(present_x []uint8, present [][]uint8, want_x []uint8) ([][]uint8, error) {
+	out, _, err := r.ReconstructUsed(present_x, present, want_x)
+	return out, err
+}
+
+// ReconstructUsed is like Reconstruct, but also returns the abscissae
+// of the present shards that the outputs were computed or copied from,
+// in the order of present_x, for auditing which survivors a recovery
+// relied on, e.g. when it produced wrong data from a corrupt one.
+func (r *Reconstructor) ReconstructUsed(present_x []uint8, present [][]uint8, want_x []uint8) (out [][]uint8, used_x []uint8, err error) {
+	if len(present_x) != len(present) {
+		return nil, nil, fmt.Errorf("Wrong number of shards: %d for %d abscissae", len(present), len(present_x))
+	}
+	if err := r.check(present_x, want_x); err != nil {
+		return nil, nil, err
+	}
+
+	var at [256]int // index in present_x + 1
+	for i, x := range present_x {
+		at[x] = i + 1
+	}
+	var used [256]bool
+	out = make([][]uint8, len(want_x))
+	var missing_x []uint8
+	var missing []int
+	for j, x := range want_x {
+		if i := at[x]; i > 0 {
+			out[j] = present[i-1]
+			used[x] = true
+		} else {
+			missing_x = append(missing_x, x)
+			missing = append(missing, j)
+		}
+	}
+
+	if len(missing) > 0 {
+		rec, err := r.coder(present_x[:r.degree], missing_x).CodeErr(present[:r.degree])
+		if err != nil {
+			return nil, nil, err
+		}
+		for m, j := range missing {
+			out[j] = rec[m]
+		}
+		for _, x := range present_x[:r.degree] {
+			used[x] = true
+		}
+	}
+
+	for _, x := range present_x {
+		if used[x] {
+			used_x = append(used_x, x)
+		}
+	}
+	return out, used_x, nil
+}
+
+// Degree returns the number of shards needed to reconstruct any other.
+func (r *Reconstructor) Degree() int {
+	return r.degree
+}
+
+// A ReconstructCache is a Reconstructor that remembers the coders it
+// constructs, for a program that reconstructs from the same sets of
+// present shards again and again.  It holds the coders for at most
+// max distinct patterns of present and wanted shards, evicting the
+// least recently used.  It is safe for concurrent use.
+type ReconstructCache struct {
+	*Reconstructor
+}
+
+// NewReconstructCache returns a ReconstructCache for a code of the
+// given degree whose shards are at the distinct abscissae all_x.
+func NewReconstructCache(degree int, all_x []uint8, max int) (*ReconstructCache, error) {
+	r, err := NewReconstructor(degree, all_x)
+	if err != nil {
+		return nil, err
+	}
+	r.coders = NewRegistry(max)
+	return &ReconstructCache{r}, nil
+}
+
+// Len returns the number of coders currently cached.
+func (c *ReconstructCache) Len() int {
+	return c.coders.Len()
+}
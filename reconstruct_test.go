@@ -0,0 +1,237 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestReconstructFetch(t *testing.T) {
+	data := randomMatrix(4, 100, 9)
+	all := NewErasureCoder([]byte{0, 1, 2, 3}, []byte{0, 1, 2, 3, 4, 5, 6}).Code(data)
+
+	var fetched []byte
+	fetch := func(x uint8) ([]byte, error) {
+		fetched = append(fetched, x)
+		if x == 4 {
+			return nil, errors.New("disk 4 is down")
+		}
+		return all[x], nil
+	}
+
+	// Have 0 and 2 in memory, need 1; 3 is lost and 4 unreachable.
+	out, err := ReconstructFetch(4, []byte{0, 2}, [][]byte{all[0], all[2]}, []byte{0, 1, 2, 3, 4, 5, 6}, func(x uint8) ([]byte, error) {
+		if x == 3 {
+			return nil, errors.New("shard 3 is lost")
+		}
+		return fetch(x)
+	}, []byte{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out[0], data[3]) {
+		t.Error("shard 3 not recovered")
+	}
+	// 1 is used, 3 and 4 fail, 5 completes the set.
+	if !bytes.Equal(fetched, []byte{1, 4, 5}) {
+		t.Error("fetched ", fetched, ", want [1 4 5]")
+	}
+
+	// Everything in memory: no fetches at all.
+	fetched = nil
+	if _, err := ReconstructFetch(4, []byte{6, 5, 4, 3}, [][]byte{all[6], all[5], all[4], all[3]}, []byte{0, 1}, fetch, []byte{0}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != 0 {
+		t.Error("fetched ", fetched, " with all shards in memory")
+	}
+
+	if _, err := ReconstructFetch(4, nil, nil, []byte{0, 1, 4}, fetch, []byte{3}); err == nil {
+		t.Error("ReconstructFetch succeeded with too few shards")
+	}
+}
+
+func TestReconstructFetchRepeatedWant(t *testing.T) {
+	all := NewErasureCoder([]byte{0, 1}, []byte{0, 1, 2}).Code(randomMatrix(2, 10, 3))
+	fetch := func(x uint8) ([]byte, error) { return all[x], nil }
+	defer SetStrictErrors(false)
+	for _, strict := range []bool{false, true} {
+		SetStrictErrors(strict)
+		out, err := ReconstructFetch(2, []byte{0, 1}, [][]byte{all[0], all[1]}, nil, fetch, []byte{2, 2})
+		if err == nil || out != nil {
+			t.Error("strict ", strict, ": ReconstructFetch accepted want_x [2 2]: ", out)
+		}
+	}
+}
+
+func TestReconstructor(t *testing.T) {
+	all_x := []byte{0, 1, 2, 3, 4, 5, 6}
+	data := randomMatrix(4, 100, 5)
+	all := NewErasureCoder([]byte{0, 1, 2, 3}, all_x).Code(data)
+
+	r, err := NewReconstructor(4, all_x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Degree() != 4 {
+		t.Error("Degree: ", r.Degree())
+	}
+
+	// Lost 0 and 2, with one extra survivor.
+	out, err := r.Reconstruct([]byte{6, 1, 4, 3, 5}, [][]byte{all[6], all[1], all[4], all[3], all[5]}, []byte{0, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out[0], data[0]) || !bytes.Equal(out[1], data[2]) {
+		t.Error("lost shards not recovered")
+	}
+
+	for _, c := range []struct {
+		present, want []byte
+	}{
+		{[]byte{1, 3, 5}, []byte{0}},    // too few
+		{[]byte{1, 3, 5, 5}, []byte{0}}, // duplicate
+		{[]byte{1, 3, 5, 9}, []byte{0}}, // not in the code
+		{[]byte{1, 3, 5, 6}, []byte{7}}, // not in the code
+	} {
+		if _, err := r.Coder(c.present, c.want); err == nil {
+			t.Errorf("Coder(%v, %v) succeeded", c.present, c.want)
+		}
+	}
+
+	if _, err := NewReconstructor(8, all_x); err == nil {
+		t.Error("NewReconstructor accepted a degree larger than the code")
+	}
+}
+
+func TestReconstructorAliasesPresentShards(t *testing.T) {
+	data := randomMatrix(3, 10, 6)
+	all := NewVandermondeCoder(3, 2).Code(data)
+	r, _ := NewReconstructor(3, []byte{0, 1, 2, 3, 4})
+
+	// Intact stripe: the data shards are returned as they are.
+	out, err := r.Reconstruct([]byte{0, 1, 2, 3}, all[:4], []byte{2, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for j, i := range []int{2, 0, 1} {
+		if &out[j][0] != &all[i][0] {
+			t.Errorf("output %d is not shard %d itself", j, i)
+		}
+	}
+
+	// Shard 1 lost: it is computed, 0 is still aliased.
+	out, err = r.Reconstruct([]byte{0, 2, 4}, [][]byte{all[0], all[2], all[4]}, []byte{0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &out[0][0] != &all[0][0] {
+		t.Error("present shard 0 was copied")
+	}
+	if !bytes.Equal(out[1], data[1]) {
+		t.Error("shard 1 not recovered")
+	}
+}
+
+func TestReconstructCache(t *testing.T) {
+	all_x := []byte{0, 1, 2, 3, 4, 5}
+	data := randomMatrix(3, 50, 10)
+	all := NewVandermondeCoder(3, 3).Code(data)
+	c, err := NewReconstructCache(3, all_x, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(present_x []byte, want int) {
+		present := make([][]byte, len(present_x))
+		for i, x := range present_x {
+			present[i] = all[x]
+		}
+		out, err := c.Reconstruct(present_x, present, []byte{byte(want)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out[0], data[want]) {
+			t.Errorf("%v: shard %d not recovered", present_x, want)
+		}
+	}
+
+	check([]byte{1, 2, 3}, 0)
+	c1, _ := c.Coder([]byte{1, 2, 3}, []byte{0})
+	check([]byte{1, 2, 3}, 0)
+	if c.Len() != 1 {
+		t.Error("Len = ", c.Len(), " after repeating a pattern")
+	}
+	if c2, _ := c.Coder([]byte{1, 2, 3}, []byte{0}); c2 != c1 {
+		t.Error("Coder not cached")
+	}
+
+	check([]byte{0, 2, 4}, 1)
+	check([]byte{3, 4, 5}, 2)
+	if c.Len() != 2 {
+		t.Error("Len = ", c.Len(), ", want 2")
+	}
+}
+
+func TestReconstructUsed(t *testing.T) {
+	all_x := []byte{0, 1, 2, 3, 4, 5, 6}
+	data := randomMatrix(3, 20, 7)
+	all := NewErasureCoder([]byte{0, 1, 2}, all_x).Code(data)
+	r, _ := NewReconstructor(3, all_x)
+	c, _ := NewReconstructCache(3, all_x, 4)
+
+	for _, tc := range []struct {
+		present_x, want_x, used_x []byte
+	}{
+		{[]byte{6, 0, 4, 1, 2}, []byte{3}, []byte{6, 0, 4}},
+		{[]byte{6, 0, 4, 1, 2}, []byte{3, 2}, []byte{6, 0, 4, 2}},
+		{[]byte{0, 1, 2, 5}, []byte{1, 2}, []byte{1, 2}},
+	} {
+		present := make([][]byte, len(tc.present_x))
+		for i, x := range tc.present_x {
+			present[i] = append([]byte(nil), all[x]...)
+		}
+		for _, rec := range []*Reconstructor{r, c.Reconstructor} {
+			out, used_x, err := rec.ReconstructUsed(tc.present_x, present, tc.want_x)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(used_x, tc.used_x) {
+				t.Errorf("present %v, want %v: used %v, want %v", tc.present_x, tc.want_x, used_x, tc.used_x)
+			}
+
+			// A shard is used iff corrupting it changes the output.
+			var is_used [256]bool
+			for _, x := range used_x {
+				is_used[x] = true
+			}
+			for i, x := range tc.present_x {
+				present[i][0] ^= 1
+				// Copied outputs alias present[], compare before undoing.
+				bad, _ := rec.Reconstruct(tc.present_x, present, tc.want_x)
+				changed := false
+				for j := range out {
+					changed = changed || bad[j][0] != all[tc.want_x[j]][0]
+				}
+				present[i][0] ^= 1
+				if changed != is_used[x] {
+					t.Errorf("present %v, want %v: shard %d changes the output: %v, reported used: %v", tc.present_x, tc.want_x, x, changed, is_used[x])
+				}
+			}
+		}
+	}
+}
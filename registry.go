@@ -0,0 +1,90 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"container/list"
+	"sync"
+)
+
+// A Registry caches ErasureCoders by the abscissae they were constructed
+// from, so that a program that needs the same few configurations over
+// and over constructs each of them only once.  When the Registry holds
+// more than its maximum number of coders, the least recently used one
+// is evicted.  A Registry is safe for concurrent use.
+//
+// Coders obtained from a Registry are shared, so callers must not use
+// methods that keep state in the coder, like CodeReuse, concurrently.
+type Registry struct {
+	mu    sync.Mutex
+	max   int
+	lru   *list.List // of *registryEntry, most recently used first
+	items map[string]*list.Element
+}
+
+type registryEntry struct {
+	key   string
+	coder *ErasureCoder
+}
+
+// NewRegistry creates a Registry holding at most max coders.
+func NewRegistry(max int) *Registry {
+	if max < 1 {
+		max = 1
+	}
+	return &Registry{max: max, lru: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Unambiguous cache key for the pair of abscissa lists.
+func registryKey(in_x, out_x []uint8) string {
+	b := make([]byte, 0, 2+len(in_x)+len(out_x))
+	b = append(b, byte(len(in_x)>>8), byte(len(in_x)))
+	b = append(b, in_x...)
+	b = append(b, out_x...)
+	return string(b)
+}
+
+// GetOrCreate returns the coder for in_x and out_x, constructing it
+// with NewErasureCoder if it is not in the Registry.
+func (r *Registry) GetOrCreate(in_x, out_x []uint8) *ErasureCoder {
+	key := registryKey(in_x, out_x)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.items[key]; ok {
+		r.lru.MoveToFront(e)
+		return e.Value.(*registryEntry).coder
+	}
+
+	c := NewErasureCoder(in_x, out_x)
+	if c == nil {
+		return nil // see SetStrictErrors
+	}
+	r.items[key] = r.lru.PushFront(&registryEntry{key, c})
+	for r.lru.Len() > r.max {
+		e := r.lru.Back()
+		r.lru.Remove(e)
+		delete(r.items, e.Value.(*registryEntry).key)
+	}
+	return c
+}
+
+// Len returns the number of coders currently in the Registry.
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lru.Len()
+}
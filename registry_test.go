@@ -0,0 +1,66 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(2)
+
+	a := r.GetOrCreate([]byte{0, 1, 2}, []byte{3, 4})
+	if b := r.GetOrCreate([]byte{0, 1, 2}, []byte{3, 4}); a != b {
+		t.Error("cache miss for identical abscissae")
+	}
+
+	// Same bytes, split differently between in_x and out_x.
+	if b := r.GetOrCreate([]byte{0, 1}, []byte{2, 3, 4}); a == b {
+		t.Error("different geometry returned the same coder")
+	}
+	if r.Len() != 2 {
+		t.Error("Len() = ", r.Len(), " != 2")
+	}
+
+	// Touch a, then evict the other one.
+	r.GetOrCreate([]byte{0, 1, 2}, []byte{3, 4})
+	r.GetOrCreate([]byte{5, 6}, []byte{7})
+	if r.Len() != 2 {
+		t.Error("Len() = ", r.Len(), " != 2")
+	}
+	if b := r.GetOrCreate([]byte{0, 1, 2}, []byte{3, 4}); a != b {
+		t.Error("most recently used coder was evicted")
+	}
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	r := NewRegistry(4)
+	var wg sync.WaitGroup
+	coders := make([]*ErasureCoder, 16)
+	for i := range coders {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			coders[i] = r.GetOrCreate([]byte{0, 1, 2}, []byte{3, 4})
+		}(i)
+	}
+	wg.Wait()
+	for _, c := range coders {
+		if c != coders[0] {
+			t.Fatal("concurrent GetOrCreate returned different coders")
+		}
+	}
+}
@@ -16,19 +16,33 @@
 // using the Galois Group GF(2^8) with characteristic polynomial x^8 + x^4 + x^3 + x^2 + 1.
 package rs
 
-import "fmt"
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
 
 // the Galois Group GG(2^8) with characteristic polynomial x^8 + x^4 + x^3 + x^2 + 1
 const (
 	cp_84320 = 1<<8 | 1<<4 | 1<<3 | 1<<2 | 1<<0
 )
 
-// multiply the hard way, only used for testing.
+// multiply the hard way, used for testing the tables and by the
+// NoTables strategy.
 func galois_multiply(aa, bb uint8) uint8 {
+	return poly_multiply(aa, bb, cp_84320)
+}
+
+// multiply the hard way in the field with characteristic polynomial cp.
+func poly_multiply(aa, bb uint8, cp uint16) uint8 {
 	var (
 		a uint16 = uint16(aa)
 		b uint16 = uint16(bb)
-		c uint16 = cp_84320 << 7
+		c uint16 = cp << 7
 		p uint16 = 0
 	)
 
@@ -51,33 +65,55 @@ func galois_multiply(aa, bb uint8) uint8 {
 	return uint8(p)
 }
 
-var (
-	exp [255]uint8
-	log [256]uint8
-	inv [256]uint8
-)
-
-func init() {
-	var a uint8 = 1
-	for i := range exp {
-		exp[i] = a
-		log[a] = uint8(i)
-		a = galois_multiply(a, 2)
+// DetectPolynomial returns the characteristic polynomial of the
+// GF(2^8) that the exponent and logarithm tables exp[] and log[] were
+// computed in, with exp[i] = g^i for some generator g and log the
+// inverse of exp, as in this package: the polynomial of the default
+// tables is 0x11D.  It returns an error if the tables are not
+// consistent with any field.
+func DetectPolynomial(exp, log []uint8) (uint16, error) {
+	if len(exp) < 255 || len(log) != 256 {
+		return 0, fmt.Errorf("Wrong table sizes: exp %d, log %d, want 255 and 256", len(exp), len(log))
+	}
+	if exp[0] != 1 {
+		return 0, fmt.Errorf("Bad exponent table: exp[0] = %d, want 1", exp[0])
+	}
+	for i := 0; i < 255; i++ {
+		if log[exp[i]] != uint8(i) {
+			return 0, fmt.Errorf("Inconsistent tables: log[exp[%d]] = %d", i, log[exp[i]])
+		}
 	}
 
-	inv[0] = 0
-	inv[1] = 1
-	for i := 2; i < 256; i++ {
-		var idx int = 255 - int(log[i])
-		inv[i] = exp[idx]
+candidates:
+	for cp := uint16(0x100); cp < 0x200; cp++ {
+		for i := 0; i < 254; i++ {
+			if poly_multiply(exp[i], exp[1], cp) != exp[i+1] {
+				continue candidates
+			}
+		}
+		if poly_multiply(exp[254], exp[1], cp) == exp[0] {
+			return cp, nil
+		}
 	}
+	return 0, fmt.Errorf("Tables are not those of any GF(2^8)")
 }
 
+// The exponent, logarithm and inverse tables of the default field,
+// shared with it rather than computed again.
+var (
+	exp = &defaultField.exp
+	log = &defaultField.log
+	inv = &defaultField.inv
+)
+
 func mult(a, b uint8) uint8 {
 	if a == 0 || b == 0 {
 		return 0
 	}
 
+	// log[] of a nonzero element is at most 254, so idx is at most 508
+	// and a single subtraction brings it into the range of exp[], which
+	// has only 255 entries: g^255 == g^0.  TestMultExtremal checks this.
 	var idx int = int(log[a]) + int(log[b])
 	// Go's % on signed types preserves sign, do it by hand.
 	if idx >= 255 {
@@ -86,8 +122,75 @@ func mult(a, b uint8) uint8 {
 	return exp[idx]
 }
 
+// Divide a by b, which must not be 0: inv[0] is 0, so open coding this
+// as mult(a, inv[b]) would silently return 0.
+func div(a, b uint8) uint8 {
+	if b == 0 {
+		panic(fmt.Errorf("Division by 0"))
+	}
+	return mult(a, inv[b])
+}
+
+// Fill tbl[] with the products of all field elements with c.
+func mulTable(c uint8, tbl *[256]uint8) {
+	for b := range tbl {
+		tbl[b] = mult(uint8(b), c)
+	}
+}
+
+// Xor src[] multiplied by the constant whose product table is tbl into
+// dst[], which must be at least as long as src[].  Keeping this loop
+// free of anything but the slice walk lets the compiler optimize it
+// much better than the nested index expressions it replaces.  This is
+// mulAddTable where there is no faster, assembly, version.  The
+// products are looked up a byte at a time, but gathered into words and
+// xored into dst[] 8 bytes at a time.
+func mulAddTableGeneric(dst, src []uint8, tbl *[256]uint8) {
+	dst = dst[:len(src)]
+	n := len(src) &^ 7
+	for j := 0; j < n; j += 8 {
+		s, d := src[j:j+8:j+8], dst[j:j+8:j+8]
+		v := uint64(tbl[s[0]]) | uint64(tbl[s[1]])<<8 | uint64(tbl[s[2]])<<16 | uint64(tbl[s[3]])<<24 |
+			uint64(tbl[s[4]])<<32 | uint64(tbl[s[5]])<<40 | uint64(tbl[s[6]])<<48 | uint64(tbl[s[7]])<<56
+		binary.LittleEndian.PutUint64(d, binary.LittleEndian.Uint64(d)^v)
+	}
+	for j := n; j < len(src); j++ {
+		dst[j] ^= tbl[src[j]]
+	}
+}
+
+// Xor src[] into dst[], which is mulAddTable for the constant 1, as
+// for the systematic outputs of a code, where it amounts to a copy.
+// The bulk is xored 8 bytes at a time; the loads and stores of
+// encoding/binary compile to single unaligned word accesses on the
+// platforms that allow them.
+func addSlice(dst, src []uint8) {
+	dst = dst[:len(src)]
+	n := len(src) &^ 7
+	for j := 0; j < n; j += 8 {
+		binary.LittleEndian.PutUint64(dst[j:], binary.LittleEndian.Uint64(dst[j:])^binary.LittleEndian.Uint64(src[j:]))
+	}
+	for j := n; j < len(src); j++ {
+		dst[j] ^= src[j]
+	}
+}
+
+// An ErasureCoder computes the values of a polynomial at a fixed set of
+// abscissae from its values at another.  It is immutable after
+// construction, and all its methods except CodeReuse only read it, so
+// one ErasureCoder can be shared by any number of goroutines.  Methods
+// that return internal state, like Matrix, return copies.  What is not
+// safe is concurrent calls that write the same out[][], like two
+// Updates of one set of parity shards: those need the caller's
+// locking.  Clone makes an independent copy.
 type ErasureCoder struct {
-	interp [][]uint8 // the Lagrange interpolation factors
+	field    *Field          // the field the factors are in
+	in_x     []uint8         // the input abscissae, nil if built from a matrix
+	out_x    []uint8         // the output abscissae, likewise
+	interp   [][]uint8       // the Lagrange interpolation factors
+	strategy Strategy        // how to multiply by them
+	tables   [][]*[256]uint8 // product tables of interp for CoefficientTables
+	reuse    [][]uint8       // output matrix recycled by CodeReuse
 }
 
 // Construct an empty X x Y matrix out of slices.
@@ -100,32 +203,109 @@ func makeMatrix(x, y int) (out [][]uint8) {
 }
 
 // Compute the Langrange interpolation factor \prod k!=i (x - x_i) / (x_k - x_i).
-func lagrange(in_x []uint8, i int, xj uint8) (r uint8) {
+func lagrange(fld *Field, in_x []uint8, i int, xj uint8) (r uint8) {
 	r = 1
 	for k, xk := range in_x {
 		if k == i {
 			continue
 		}
-		f := mult(xj^xk, inv[in_x[i]^xk])
-		r = mult(r, f)
+		f := fld.Div(xj^xk, in_x[i]^xk)
+		r = fld.Mul(r, f)
 	}
 	return
 }
 
+// LagrangeFactor returns the factor by which the value at in_x[i]
+// contributes to the value at the abscissa at of the polynomial through
+// the values at in_x[], i.e. the Lagrange basis polynomial of in_x[i]
+// evaluated at at.  The Matrix() of NewErasureCoder(in_x, out_x) is
+// made of these: its entry [i][j] is LagrangeFactor(in_x, i, out_x[j]).
+// The in_x[] must be distinct, and i in range, or it panics.
+func LagrangeFactor(in_x []uint8, i int, at uint8) uint8 {
+	return defaultField.LagrangeFactor(in_x, i, at)
+}
+
+// LagrangeFactor is like the package function LagrangeFactor, but over f.
+func (f *Field) LagrangeFactor(in_x []uint8, i int, at uint8) uint8 {
+	if err := abscissaeError("in_x", in_x); err != nil {
+		fail(err)
+		return 0
+	}
+	if i < 0 || i >= len(in_x) {
+		fail(fmt.Errorf("Abscissa index out of range %d for %d abscissae", i, len(in_x)))
+		return 0
+	}
+	return lagrange(f, in_x, i, at)
+}
+
 // NewErasureCoder creates a de/encoder that can compute P(out_x[]) from P(in_x[])
 // The polynomial P is of degree len(in_x), and P(in_x[i]) = d[i]
-// for inputs d[].
+// for inputs d[].  The in_x[] must be distinct, or there is no such
+// polynomial, and so must the out_x[]; NewErasureCoder panics if they
+// are not.
 func NewErasureCoder(in_x, out_x []uint8) (p *ErasureCoder) {
-	p = new(ErasureCoder)
-	p.interp = makeMatrix(len(in_x), len(out_x))
+	return NewErasureCoderField(defaultField, in_x, out_x)
+}
+
+// NewErasureCoderField is like NewErasureCoder, but works in the given
+// field rather than the package's default one.
+func NewErasureCoderField(field *Field, in_x, out_x []uint8) (p *ErasureCoder) {
+	if err := coderAbscissaeError(in_x, out_x); err != nil {
+		fail(err)
+		return nil
+	}
+
+	interp := makeMatrix(len(in_x), len(out_x))
 	for i := range in_x {
 		for j := range out_x {
-			p.interp[i][j] = lagrange(in_x, i, out_x[j])
+			interp[i][j] = lagrange(field, in_x, i, out_x[j])
 		}
 	}
+	p = newCoder(field, interp)
+	p.in_x = append([]uint8(nil), in_x...)
+	p.out_x = append([]uint8(nil), out_x...)
 	return
 }
 
+// Construct an ErasureCoder for the Degree() x NumOutputs() matrix
+// interp, which it takes ownership of.
+func newCoder(field *Field, interp [][]uint8) *ErasureCoder {
+	p := &ErasureCoder{field: field, interp: interp}
+	p.setStrategy(chooseStrategy(p.interp))
+	return p
+}
+
+// Check that the abscissae x[], named name in messages, are distinct.
+// There are only 256 of them in GF(2^8), so this also bounds len(x).
+func abscissaeError(name string, x []uint8) error {
+	if len(x) > 256 {
+		return fmt.Errorf("Too many abscissae in %s: %d, GF(2^8) has only 256", name, len(x))
+	}
+	var seen [256]bool
+	for _, v := range x {
+		if seen[v] {
+			return fmt.Errorf("Abscissa %d appears twice in %s", v, name)
+		}
+		seen[v] = true
+	}
+	return nil
+}
+
+// Check the abscissae of a coder: the in_x[] must be distinct for the
+// polynomial to be determined, and the out_x[] too, as computing the
+// same output twice is a mistake that would go unnoticed until the
+// duplicate is relied on.  out_x[] may share abscissae with in_x[]; for
+// those the output is a copy of the input.
+func coderAbscissaeError(in_x, out_x []uint8) error {
+	if len(in_x) == 0 {
+		return fmt.Errorf("No abscissae in in_x")
+	}
+	if err := abscissaeError("in_x", in_x); err != nil {
+		return err
+	}
+	return abscissaeError("out_x", out_x)
+}
+
 // Return the degree of the computed polynomial, which is equal to the number of inputs.
 func (p *ErasureCoder) Degree() int {
 	return len(p.interp)
@@ -136,6 +316,170 @@ func (p *ErasureCoder) NumOutputs() int {
 	return len(p.interp[0])
 }
 
+// Clone returns a deep copy of the ErasureCoder, sharing no state with
+// it, not even the buffer of CodeReuse.
+func (p *ErasureCoder) Clone() *ErasureCoder {
+	q := &ErasureCoder{field: p.field, interp: p.Matrix()}
+	if p.in_x != nil {
+		q.in_x = p.InputAbscissae()
+		q.out_x = p.OutputAbscissae()
+	}
+	q.setStrategy(p.strategy)
+	return q
+}
+
+// WithExtraOutputs returns a coder like p, with the outputs at the
+// abscissae extra[] following p's, e.g. to add parity shards to a
+// stripe encoded earlier: the existing outputs stay as they are, and
+// coding the original inputs with the new coder gives the extra ones
+// too.  Only the factors of the new outputs are computed, the others
+// are copied, and so is p's Strategy.  p must have been constructed
+// from abscissae, and the extra[] must be distinct from each other and
+// from p's outputs, or WithExtraOutputs panics.
+func (p *ErasureCoder) WithExtraOutputs(extra []uint8) *ErasureCoder {
+	if p.in_x == nil {
+		fail(fmt.Errorf("Can't add outputs to a coder without abscissae"))
+		return nil
+	}
+	out_x := append(p.OutputAbscissae(), extra...)
+	if err := coderAbscissaeError(p.in_x, out_x); err != nil {
+		fail(err)
+		return nil
+	}
+	interp := make([][]uint8, len(p.interp))
+	for i, row := range p.interp {
+		interp[i] = append(make([]uint8, 0, len(out_x)), row...)
+		for _, x := range extra {
+			interp[i] = append(interp[i], lagrange(p.field, p.in_x, i, x))
+		}
+	}
+	q := &ErasureCoder{field: p.field, interp: interp, in_x: p.InputAbscissae(), out_x: out_x}
+	q.setStrategy(p.strategy)
+	return q
+}
+
+// InputAbscissae returns a copy of the in_x[] the ErasureCoder was
+// constructed with, or nil if it was constructed from a matrix, like
+// CoderFromMatrix or NewCauchyCoder do.
+func (p *ErasureCoder) InputAbscissae() []uint8 {
+	return append([]uint8(nil), p.in_x...)
+}
+
+// OutputAbscissae is like InputAbscissae, for out_x[].
+func (p *ErasureCoder) OutputAbscissae() []uint8 {
+	return append([]uint8(nil), p.out_x...)
+}
+
+// String summarizes the ErasureCoder as its degree, number of outputs
+// and abscissae, and its field if it isn't the default one.  Compare
+// the GoString of the encoder and decoder to find a mismatch in their
+// matrices.
+func (p *ErasureCoder) String() string {
+	s := fmt.Sprintf("ErasureCoder{degree %d, %d outputs", p.Degree(), p.NumOutputs())
+	if p.in_x != nil {
+		s += fmt.Sprintf(", in_x %v, out_x %v", p.in_x, p.out_x)
+	}
+	if p.field != defaultField {
+		s += fmt.Sprintf(", field %#x", p.field.Polynomial())
+	}
+	return s + "}"
+}
+
+// GoString returns the Go expression that rebuilds the ErasureCoder
+// from its full matrix of factors, in hex, with a comment naming the
+// field if it isn't the default one.
+func (p *ErasureCoder) GoString() string {
+	var b strings.Builder
+	if p.field != defaultField {
+		fmt.Fprintf(&b, "/* field %#x */ ", p.field.Polynomial())
+	}
+	b.WriteString("rs.CoderFromMatrix([][]uint8{")
+	for i, row := range p.interp {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("{")
+		for k, c := range row {
+			if k > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "0x%02x", c)
+		}
+		b.WriteString("}")
+	}
+	b.WriteString("})")
+	return b.String()
+}
+
+// AffectedOutputs returns the indices of the outputs that depend on
+// input idx, i.e. those that an Update of input idx will change.
+func (p *ErasureCoder) AffectedOutputs(idx int) []int {
+	if idx < 0 || idx >= p.Degree() {
+		fail(fmt.Errorf("Input index out of range %d for polynomial of degree %d", idx, p.Degree()))
+		return nil
+	}
+	var r []int
+	for k, c := range p.interp[idx] {
+		if c != 0 {
+			r = append(r, k)
+		}
+	}
+	return r
+}
+
+// Matrix returns a copy of the Degree() x NumOutputs() matrix of
+// interpolation factors: Matrix()[i][k] is the factor input i is
+// multiplied with in output k.  This is the transpose of EncodingMatrix.
+func (p *ErasureCoder) Matrix() [][]uint8 {
+	m := makeMatrix(p.Degree(), p.NumOutputs())
+	for i := range p.interp {
+		copy(m[i], p.interp[i])
+	}
+	return m
+}
+
+// CoderFromMatrix returns the ErasureCoder whose Matrix() is a copy of
+// m, e.g. as saved from an earlier coder to skip recomputing the
+// interpolation factors.  m must have at least one row, and all rows
+// must be of the same length.  The matrix is taken to be over the
+// package's default field; use CoderFromMatrixField for others.
+func CoderFromMatrix(m [][]uint8) *ErasureCoder {
+	return CoderFromMatrixField(defaultField, m)
+}
+
+// CoderFromMatrixField is like CoderFromMatrix, but for a matrix over
+// the given field.
+func CoderFromMatrixField(field *Field, m [][]uint8) *ErasureCoder {
+	if len(m) == 0 {
+		fail(fmt.Errorf("Empty matrix"))
+		return nil
+	}
+	interp := makeMatrix(len(m), len(m[0]))
+	for i := range m {
+		if len(m[i]) != len(m[0]) {
+			fail(fmt.Errorf("Ragged matrix: row %d has %d columns, row 0 has %d", i, len(m[i]), len(m[0])))
+			return nil
+		}
+		copy(interp[i], m[i])
+	}
+	return newCoder(field, interp)
+}
+
+// EncodingMatrix returns the NumOutputs() x Degree() matrix M such that
+// out[k][j] = sum_i M[k][i] * in[i][j] for out = Code(in), with sum and
+// product taken in GF(2^8).  That is, M maps a column of input symbols
+// to a column of output symbols, the orientation other Reed-Solomon
+// tools use for their generator matrices.  M is a fresh copy.
+func (p *ErasureCoder) EncodingMatrix() [][]uint8 {
+	m := makeMatrix(p.NumOutputs(), p.Degree())
+	for i := range p.interp {
+		for k, v := range p.interp[i] {
+			m[k][i] = v
+		}
+	}
+	return m
+}
+
 // De/Encode in[] to out[] by recovering the polynomial and evaluating
 // at the out_x abscissae.  The out[] will have as many elements as
 // the out_x array passed to NewErasureCoder.  All rows of the in[]
@@ -143,56 +487,500 @@ func (p *ErasureCoder) NumOutputs() int {
 // size too. The in[] matrix must have the same number of columns as
 // the degree of the Erasurecoder.  (Since these preconditions can be
 // checked by the user, i've chosen to panic() rather than return an
-// error variable if they are not satisfied.)
+// error variable if they are not satisfied, but see SetStrictErrors.)
+// A nil row in in[] stands for an all-zero input, e.g. a hole in a
+// sparse file, and is skipped without being read; the other rows must
+// still be of equal size.  This holds for all methods that take an
+// input matrix like Code's.  Empty inputs, or all nil ones, are blocks
+// of length 0, for which the outputs are NumOutputs() empty rows.
 func (p *ErasureCoder) Code(in [][]uint8) (out [][]uint8) {
+	if err := p.inputError(in); err != nil {
+		fail(err)
+		return nil
+	}
+	out = makeMatrix(len(p.interp[0]), blockSize(in))
+	p.CodeInto(in, out)
+	return
+}
+
+// CodeErr is like Code, but returns an error rather than panicking if
+// its preconditions are not met, for servers that code untrusted input
+// and would rather not recover() from panics.
+func (p *ErasureCoder) CodeErr(in [][]uint8) ([][]uint8, error) {
+	if err := p.inputError(in); err != nil {
+		return nil, err
+	}
+	out := makeMatrix(len(p.interp[0]), blockSize(in))
+	p.code(in, out)
+	return out, nil
+}
+
+// CodeInto is like Code, but computes into the caller supplied out[],
+// which must have NumOutputs() rows of the same size as the inputs, so
+// that loops coding block after block can recycle their buffers.  out[]
+// is zeroed first, its previous contents don't matter.
+func (p *ErasureCoder) CodeInto(in, out [][]uint8) {
+	if err := p.inputError(in); err != nil {
+		fail(err)
+		return
+	}
+	if err := p.outputError(out, blockSize(in)); err != nil {
+		fail(err)
+		return
+	}
+	for k := range out {
+		for j := range out[k] {
+			out[k][j] = 0
+		}
+	}
+	p.code(in, out)
+}
+
+// EncodeAll returns the full stripe of data[] followed by its outputs
+// as computed by Code, typically for a coder whose out_x are the parity
+// abscissae.  The first Degree() rows are data[i] themselves, not
+// copies: writing to them writes to data[], and vice versa.  Only the
+// outputs are freshly allocated, so encoding never doubles the memory
+// held by large data shards.
+func (p *ErasureCoder) EncodeAll(data [][]uint8) [][]uint8 {
+	out := p.Code(data)
+	if out == nil {
+		return nil
+	}
+	shards := make([][]uint8, 0, len(data)+len(out))
+	shards = append(shards, data...)
+	return append(shards, out...)
+}
+
+// CodeFixed is CodeInto, under a name that states its guarantee:
+// it allocates nothing and never grows or reslices any of the
+// buffers, so it is safe to call from a hot loop that must not
+// allocate, with statically allocated buffers.
+func (p *ErasureCoder) CodeFixed(in, out [][]uint8) {
+	p.CodeInto(in, out)
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// CodeFixedCRC is like CodeFixed, but also sets crcs[k] to the CRC-32C
+// (Castagnoli) checksum of out[k].  Each output row is computed in
+// full and checksummed right away, while it is still in cache, rather
+// than in a separate pass over the outputs.  crcs[] must have
+// NumOutputs() elements.
+func (p *ErasureCoder) CodeFixedCRC(in, out [][]uint8, crcs []uint32) {
+	if err := p.inputError(in); err != nil {
+		fail(err)
+		return
+	}
+	if err := p.outputError(out, blockSize(in)); err != nil {
+		fail(err)
+		return
+	}
+	if len(crcs) != len(out) {
+		fail(fmt.Errorf("Wrong number of checksums: %d != %d", len(crcs), len(out)))
+		return
+	}
+
+	for k := range out {
+		for j := range out[k] {
+			out[k][j] = 0
+		}
+		for i := range in {
+			if c := p.interp[i][k]; c != 0 && len(in[i]) > 0 {
+				p.mulAdd(out[k], in[i], i, k)
+			}
+		}
+		crcs[k] = crc32.Checksum(out[k], castagnoli)
+	}
+}
+
+// Check that out[] has NumOutputs() rows of length n.
+func (p *ErasureCoder) outputError(out [][]uint8, n int) error {
+	if len(out) != p.NumOutputs() {
+		return fmt.Errorf("Wrong number of outputs: %d for Erasure coder with %d outputs", len(out), p.NumOutputs())
+	}
+	for k := range out {
+		if len(out[k]) != n {
+			return fmt.Errorf("Output row of wrong size: [%d]%d != %d, row lengths %s", k, len(out[k]), n, rowLengths(out))
+		}
+	}
+	return nil
+}
+
+// CodeRange is like Code, but only computes the columns [col0, col1)
+// of the output.  Since every output column depends only on the same
+// column of the inputs, a large stripe can be split into column
+// ranges that are coded independently, e.g. on different machines,
+// and the resulting rows concatenated to obtain the output of Code.
+// For that the ranges must tile [0, n) exactly, without gaps or
+// overlap, where n is the length of the input rows.
+func (p *ErasureCoder) CodeRange(in [][]uint8, col0, col1 int) (out [][]uint8) {
+	if err := p.inputError(in); err != nil {
+		fail(err)
+		return nil
+	}
+	if n := blockSize(in); col0 < 0 || col1 < col0 || col1 > n {
+		fail(fmt.Errorf("Column range [%d,%d) out of range for block size %d", col0, col1, n))
+		return nil
+	}
+
+	sub := make([][]uint8, len(in))
+	for i := range in {
+		if in[i] != nil {
+			sub[i] = in[i][col0:col1]
+		}
+	}
+	out = makeMatrix(len(p.interp[0]), col1-col0)
+	p.code(sub, out)
+	return
+}
+
+// CodePadded is like Code, but in[] may be ragged: each input is taken
+// to be padded with zeros to the length n of the longest, and the
+// outputs are of length n.  The inputs are not copied or modified.
+func (p *ErasureCoder) CodePadded(in [][]uint8) (out [][]uint8, n int) {
 	if len(in) != p.Degree() {
-		panic(fmt.Errorf("Wrong number of inputs: %d for Erasure coder of degree: %d", len(in), p.Degree()))
+		fail(fmt.Errorf("Wrong number of inputs: %d for Erasure coder of degree: %d", len(in), p.Degree()))
+		return nil, 0
 	}
+	for _, row := range in {
+		if n < len(row) {
+			n = len(row)
+		}
+	}
+	// mulAdd only touches the first len(src) bytes of dst[], so the
+	// short inputs are implicitly zero padded.
+	out = makeMatrix(p.NumOutputs(), n)
+	p.code(in, out)
+	return out, n
+}
 
+// CodeOne is like Code, but only computes the output at out_x[out_idx],
+// e.g. to repair a single lost shard, and costs a NumOutputs()'th of it.
+func (p *ErasureCoder) CodeOne(out_idx int, in [][]uint8) []uint8 {
+	out := p.CodeSubset([]int{out_idx}, in)
+	if out == nil {
+		return nil
+	}
+	return out[0]
+}
+
+// CodeSubset is like Code, but only computes the outputs at
+// out_x[out_idxs[j]], returned as out[j].
+func (p *ErasureCoder) CodeSubset(out_idxs []int, in [][]uint8) (out [][]uint8) {
+	if err := p.inputError(in); err != nil {
+		fail(err)
+		return nil
+	}
+	for _, k := range out_idxs {
+		if k < 0 || k >= p.NumOutputs() {
+			fail(fmt.Errorf("Output index out of range %d for %d outputs", k, p.NumOutputs()))
+			return nil
+		}
+	}
+
+	out = makeMatrix(len(out_idxs), blockSize(in))
+	for j, k := range out_idxs {
+		p.codeOne(in, k, out[j])
+	}
+	return
+}
+
+// Xor the evaluation of the polynomial through in[] at out_x[k] into
+// the zeroed dst[].
+func (p *ErasureCoder) codeOne(in [][]uint8, k int, dst []uint8) {
 	for i := 0; i < len(in); i++ {
-		if len(in[i]) != len(in[0]) {
-			panic(fmt.Errorf("Ragged input matrix: [0]%d != [%d]%d  ", len(in[0]), i, len(in[i])))
+		if len(in[i]) == 0 {
+			continue
+		}
+		p.mulAdd(dst, in[i], i, k)
+	}
+}
+
+// CodeReuse is like Code, but computes into an output matrix owned by
+// the ErasureCoder instead of allocating a fresh one on every call.
+// The returned matrix is only valid until the next call to CodeReuse
+// on the same ErasureCoder, which will overwrite it (and may resize
+// it if the block size changed).  Copy out anything you need to keep.
+// Because of this shared state, CodeReuse must not be called
+// concurrently on the same ErasureCoder.
+func (p *ErasureCoder) CodeReuse(in [][]uint8) [][]uint8 {
+	if err := p.inputError(in); err != nil {
+		fail(err)
+		return nil
+	}
+	n := blockSize(in)
+	if p.reuse == nil || (len(p.reuse) > 0 && cap(p.reuse[0]) < n) {
+		p.reuse = makeMatrix(len(p.interp[0]), n)
+	}
+	for k := range p.reuse {
+		p.reuse[k] = p.reuse[k][:n]
+		for j := range p.reuse[k] {
+			p.reuse[k][j] = 0
+		}
+	}
+	p.code(in, p.reuse)
+	return p.reuse
+}
+
+// Check the preconditions of Code on in[].
+func (p *ErasureCoder) inputError(in [][]uint8) error {
+	if len(in) != p.Degree() {
+		return fmt.Errorf("Wrong number of inputs: %d for Erasure coder of degree: %d", len(in), p.Degree())
+	}
+
+	first := -1
+	for i := 0; i < len(in); i++ {
+		if in[i] == nil {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		if len(in[i]) != len(in[first]) {
+			return fmt.Errorf("Ragged input matrix: [%d]%d != [%d]%d, row lengths %s", first, len(in[first]), i, len(in[i]), rowLengths(in))
+		}
+	}
+	return nil
+}
+
+// Format the lengths of the rows of m, nil ones as nil, e.g.
+// [100 100 nil 97], so that a ragged matrix shows all its odd rows at
+// once rather than only the first.
+func rowLengths(m [][]uint8) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, r := range m {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		if r == nil {
+			b.WriteString("nil")
+		} else {
+			fmt.Fprint(&b, len(r))
+		}
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// Return the length of the non-nil rows of in[], or 0 if all are nil.
+func blockSize(in [][]uint8) int {
+	for _, r := range in {
+		if r != nil {
+			return len(r)
 		}
 	}
+	return 0
+}
 
-	out = makeMatrix(len(p.interp[0]), len(in[0]))
+// Xor the evaluation of the polynomial through in[] into the zeroed out[].
+func (p *ErasureCoder) code(in, out [][]uint8) {
 	for i := 0; i < len(in); i++ {
-		for j := 0; j < len(in[i]); j++ {
-			for k := 0; k < len(p.interp[i]); k++ {
-				out[k][j] ^= mult(in[i][j], p.interp[i][k])
+		if len(in[i]) == 0 {
+			continue
+		}
+		for k := 0; k < len(p.interp[i]); k++ {
+			p.mulAdd(out[k], in[i], i, k)
+		}
+	}
+}
+
+// QuickCheck reports whether shards[] is a consistent stripe: the
+// first Degree() rows are taken as the inputs, and the remaining
+// NumOutputs() rows must be exactly what Code would compute from
+// them.  Only the outputs are recomputed, so this is the cheapest
+// consistency check there is, suitable for periodic scrubbing.  It
+// panics like Code if the input rows are malformed.
+func (p *ErasureCoder) QuickCheck(shards [][]uint8) bool {
+	if len(shards) != p.Degree()+p.NumOutputs() {
+		fail(fmt.Errorf("Wrong number of shards: %d for Erasure coder with %d inputs and %d outputs", len(shards), p.Degree(), p.NumOutputs()))
+		return false
+	}
+
+	out := p.Code(shards[:p.Degree()])
+	if out == nil {
+		return false
+	}
+	for k, o := range out {
+		if !bytes.Equal(o, shards[p.Degree()+k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Diff recomputes the outputs from data[] and returns their xor with
+// the stored_parity[], as well as whether they were all equal, in which
+// case the diff is all zero.  A few nonzero bytes in the diff point at
+// localized corruption, a dense row at a wholesale bad shard (or a
+// wrong input).  data[] must satisfy the preconditions of Code, and
+// stored_parity[] must have as many rows of the same size as Code
+// would return.
+func (p *ErasureCoder) Diff(data, stored_parity [][]uint8) (diff [][]uint8, clean bool) {
+	diff = p.Code(data)
+	if diff == nil {
+		return nil, false
+	}
+	if len(stored_parity) != len(diff) {
+		fail(fmt.Errorf("Wrong number of parity rows: %d != %d", len(stored_parity), len(diff)))
+		return nil, false
+	}
+	for k := range stored_parity {
+		if len(stored_parity[k]) != len(diff[k]) {
+			fail(fmt.Errorf("Ragged or uneven parity matrix: [%d]%d != %d  ", k, len(stored_parity[k]), len(diff[k])))
+			return nil, false
+		}
+	}
+
+	clean = true
+	for k := range diff {
+		for j, v := range stored_parity[k] {
+			diff[k][j] ^= v
+			if diff[k][j] != 0 {
+				clean = false
 			}
 		}
 	}
-	return
+	return diff, clean
 }
 
-// Update out[][] for an update of the abscissa in_x with values
-// in_delta[].  in_delta should be the xor of the original value with
-// the update.  the lenght of in_delta and the lenghts of the elements
-// of out should all be the same, idx is the index into in_x[] passed
-// to NewErasurecoder, and out should have as many elements as
-// out_x[].  Typically out[][] was returned by an earlier call to
-// Code().  Alternatively out[][] can be a zero matrix of the right
-// dimension, and it can be xor-ed by the caller with an earlier
-// output of Code().
+// Update out[][] for an update of input idx with values in_delta[].
+// in_delta should be the xor of the original value with the update.
+// the lenght of in_delta and the lenghts of the elements of out should
+// all be the same, and out should have as many elements as out_x[].
+// Note that idx is the index into in_x[] passed to NewErasureCoder,
+// from 0 to Degree()-1, not the abscissa in_x[idx] itself: for in_x
+// {10, 20, 30}, the input at abscissa 20 is updated with idx 1.
+// Typically out[][] was returned by an earlier call to Code().
+// Alternatively out[][] can be a zero matrix of the right dimension,
+// and it can be xor-ed by the caller with an earlier output of Code().
+// An empty in_delta with empty out[] rows is a no-op.
 func (p *ErasureCoder) Update(idx uint8, in_delta []uint8, out [][]uint8) {
-	if idx >= uint8(len(p.interp)) {
-		panic(fmt.Errorf("Abscissa index out of range %d for polynomial of degree %d", idx, len(p.interp)))
+	if err := p.UpdateErr(idx, in_delta, out); err != nil {
+		fail(err)
+	}
+}
+
+// UpdateErr is like Update, but returns an error rather than panicking
+// if its preconditions are not met, in which case out[][] is untouched.
+func (p *ErasureCoder) UpdateErr(idx uint8, in_delta []uint8, out [][]uint8) error {
+	if err := p.updateError(idx, in_delta, out); err != nil {
+		return err
+	}
+
+	for k := 0; k < len(p.interp[idx]); k++ {
+		if c := p.interp[idx][k]; c != 0 {
+			p.mulAdd(out[k], in_delta, int(idx), k)
+		}
+	}
+	return nil
+}
+
+// UpdateMulti is Update for the deltas[j] to the inputs at idxs[j],
+// applied together in one pass over out[][]: each output row is
+// visited once, rather than once per delta.
+func (p *ErasureCoder) UpdateMulti(idxs []uint8, deltas [][]uint8, out [][]uint8) {
+	if len(idxs) != len(deltas) {
+		fail(fmt.Errorf("Wrong number of deltas: %d for %d indices", len(deltas), len(idxs)))
+		return
+	}
+	for j, idx := range idxs {
+		if err := p.updateError(idx, deltas[j], out); err != nil {
+			fail(err)
+			return
+		}
+	}
+
+	for k := range out {
+		for j, idx := range idxs {
+			if c := p.interp[idx][k]; c != 0 {
+				p.mulAdd(out[k], deltas[j], int(idx), k)
+			}
+		}
+	}
+}
+
+// Check the preconditions of Update.
+func (p *ErasureCoder) updateError(idx uint8, in_delta []uint8, out [][]uint8) error {
+	if int(idx) >= len(p.interp) {
+		return fmt.Errorf("Abscissa index out of range %d for polynomial of degree %d", idx, len(p.interp))
 	}
 
 	if len(out) != len(p.interp[0]) {
-		panic(fmt.Errorf("Wrong number of in/outputs: %d != %d", len(out), len(p.interp[0])))
+		return fmt.Errorf("Wrong number of in/outputs: %d != %d", len(out), len(p.interp[0]))
 	}
 
 	for i := 0; i < len(out); i++ {
 		if len(in_delta) != len(out[i]) {
-			panic(fmt.Errorf("Ragged or uneven input matrices: in %d != out[%d]%d  ", len(in_delta), i, len(out[i])))
+			return fmt.Errorf("Ragged or uneven input matrices: in %d != out[%d]%d, out row lengths %s", len(in_delta), i, len(out[i]), rowLengths(out))
 		}
 	}
-	for j := 0; j < len(in_delta); j++ {
-		for k := 0; k < len(p.interp[idx]); k++ {
-			out[k][j] ^= mult(in_delta[j], p.interp[idx][k])
-		}
+	return nil
+}
+
+// UpdateWithScratch is like Update, but takes the old and the new
+// contents of input idx rather than their xor.  The delta is computed
+// into scratch[], which must be at least as long as the blocks, so
+// that repeated updates need not allocate.
+func (p *ErasureCoder) UpdateWithScratch(idx uint8, old_block, new_block []uint8, out [][]uint8, scratch []uint8) {
+	if len(old_block) != len(new_block) {
+		fail(fmt.Errorf("Old and new block differ in length: %d != %d", len(old_block), len(new_block)))
+		return
 	}
-	return
+
+	if len(scratch) < len(old_block) {
+		fail(fmt.Errorf("Scratch buffer too short: %d < %d", len(scratch), len(old_block)))
+		return
+	}
+
+	delta := scratch[:len(old_block)]
+	for j := range delta {
+		delta[j] = old_block[j] ^ new_block[j]
+	}
+	p.Update(idx, delta, out)
+}
+
+var (
+	strictErrors int32 // set atomically
+
+	lastErrorMu sync.Mutex
+	lastError   error
+)
+
+// SetStrictErrors switches how the ErasureCoder methods report
+// violated preconditions.  By default they panic.  After
+// SetStrictErrors(true) they instead record the error for LastError and
+// return without doing anything, methods that return a matrix
+// returning nil.  This is a migration aid for programs that cannot
+// afford a panic but have not yet been changed to check their inputs.
+// The setting is global and may be flipped from any goroutine.
+func SetStrictErrors(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&strictErrors, v)
+}
+
+// LastError returns and clears the error recorded by the most recent
+// failing call in strict error mode.  There is only one such error for
+// all goroutines, so concurrent users can't tell whose call failed,
+// only that one did.
+func LastError() error {
+	lastErrorMu.Lock()
+	defer lastErrorMu.Unlock()
+	err := lastError
+	lastError = nil
+	return err
+}
+
+// Report a violated precondition, see SetStrictErrors.
+func fail(err error) {
+	if atomic.LoadInt32(&strictErrors) == 0 {
+		panic(err)
+	}
+	lastErrorMu.Lock()
+	lastError = err
+	lastErrorMu.Unlock()
 }
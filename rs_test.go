@@ -16,6 +16,11 @@ package rs
 
 import (
 	"bytes"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -125,3 +130,1041 @@ func TestUpdatePanicOnBadInput(t *testing.T) {
 	c.Update(0, []byte{1}, out) // should panic
 	t.Error("Failed to panic")
 }
+
+func TestCodeReuse(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+
+	// Shrink and grow the block size so the reused buffer gets resliced
+	// and reallocated.
+	for _, n := range []int{16, 5, 0, 7, 64, 3} {
+		in := make([][]byte, 3)
+		for i := range in {
+			in[i] = make([]byte, n)
+			for j := range in[i] {
+				in[i][j] = byte(i*31 + j*7 + n)
+			}
+		}
+
+		want := c.Code(in)
+		got := c.CodeReuse(in)
+		if len(got) != len(want) {
+			t.Fatalf("block size %d: %d outputs, want %d", n, len(got), len(want))
+		}
+		for k := range want {
+			if !bytes.Equal(got[k], want[k]) {
+				t.Errorf("block size %d: output %d: %v != %v", n, k, got[k], want[k])
+			}
+		}
+	}
+}
+
+func TestQuickCheck(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	in := [][]byte{
+		[]byte{1, 2, 3, 4, 5},
+		[]byte{41, 42, 43, 44, 45},
+		[]byte{11, 22, 33, 44, 55},
+	}
+	shards := append(in, c.Code(in)...)
+
+	if !c.QuickCheck(shards) {
+		t.Error("QuickCheck failed on a consistent stripe")
+	}
+
+	shards[4][2] ^= 1
+	if c.QuickCheck(shards) {
+		t.Error("QuickCheck missed a corrupted parity byte")
+	}
+	shards[4][2] ^= 1
+
+	shards[1][0] ^= 0x80
+	if c.QuickCheck(shards) {
+		t.Error("QuickCheck missed a corrupted data byte")
+	}
+}
+
+func BenchmarkQuickCheck(b *testing.B) {
+	const n = 128 << 10
+	c := NewErasureCoder([]byte{0, 1, 2, 3}, []byte{4, 5})
+	in := makeMatrix(4, n)
+	for i := range in {
+		for j := range in[i] {
+			in[i][j] = byte(i + j)
+		}
+	}
+	shards := append(in, c.Code(in)...)
+
+	b.SetBytes(4 * n)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !c.QuickCheck(shards) {
+			b.Fatal("QuickCheck failed")
+		}
+	}
+}
+
+func TestReconstructParity(t *testing.T) {
+	in := [][]byte{
+		[]byte{1, 2, 3, 4, 5},
+		[]byte{41, 42, 43, 44, 45},
+		[]byte{11, 22, 33, 44, 55},
+	}
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4, 5})
+	parity := c.Code(in)
+
+	// Lose parity shard 4 and regenerate it from data 0, 2 and parity 3.
+	c2 := NewErasureCoder([]byte{0, 2, 3}, []byte{4})
+	out := c2.Code([][]byte{in[0], in[2], parity[0]})
+	if !bytes.Equal(out[0], parity[1]) {
+		t.Error(out[0], " != ", parity[1])
+	}
+
+	// Lose data shard 1 and parity shard 4, regenerate both in one go.
+	c3 := NewErasureCoder([]byte{0, 3, 5}, []byte{1, 4})
+	out = c3.Code([][]byte{in[0], parity[0], parity[2]})
+	if !bytes.Equal(out[0], in[1]) {
+		t.Error(out[0], " != ", in[1])
+	}
+	if !bytes.Equal(out[1], parity[1]) {
+		t.Error(out[1], " != ", parity[1])
+	}
+}
+
+func TestUpdateWithScratch(t *testing.T) {
+	in := [][]byte{
+		[]byte{1, 2, 3, 4, 5},
+		[]byte{41, 42, 43, 44, 45},
+		[]byte{11, 22, 33, 44, 55},
+	}
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	out := c.Code(in)
+
+	scratch := make([]byte, 8)
+	in_updated := []byte{51, 62, 73, 84, 95}
+	c.UpdateWithScratch(2, in[2], in_updated, out, scratch)
+	in[2] = in_updated
+
+	want := c.Code(in)
+	for k := range want {
+		if !bytes.Equal(out[k], want[k]) {
+			t.Error(out[k], " != ", want[k])
+		}
+	}
+}
+
+func TestUpdateWithScratchPanicOnShortScratch(t *testing.T) {
+	defer recoverExpected(t)
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	out := [][]byte{[]byte{0, 0}, []byte{0, 0}}
+	c.UpdateWithScratch(0, []byte{1, 2}, []byte{3, 4}, out, []byte{0}) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestEncodingMatrix(t *testing.T) {
+	in := [][]byte{
+		[]byte{1, 2, 3, 4, 5},
+		[]byte{41, 42, 43, 44, 45},
+		[]byte{11, 22, 33, 44, 55},
+	}
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{0, 3, 4, 7})
+	out := c.Code(in)
+
+	m := c.EncodingMatrix()
+	if len(m) != 4 || len(m[0]) != 3 {
+		t.Fatalf("EncodingMatrix is %dx%d, want 4x3", len(m), len(m[0]))
+	}
+
+	// Output 0 is input 0.
+	if !bytes.Equal(m[0], []byte{1, 0, 0}) {
+		t.Error("row 0: ", m[0])
+	}
+
+	for k := range m {
+		for j := range in[0] {
+			var v byte
+			for i := range in {
+				v ^= galois_multiply(m[k][i], in[i][j])
+			}
+			if v != out[k][j] {
+				t.Errorf("(M * in)[%d][%d] = %d != %d", k, j, v, out[k][j])
+			}
+		}
+	}
+}
+
+func TestStrictErrors(t *testing.T) {
+	SetStrictErrors(true)
+	defer SetStrictErrors(false)
+
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	if out := c.Code([][]byte{[]byte{1}}); out != nil {
+		t.Error("Code returned ", out, " for bad input")
+	}
+	if LastError() == nil {
+		t.Error("Code recorded no error")
+	}
+	if err := LastError(); err != nil {
+		t.Error("LastError did not clear: ", err)
+	}
+
+	out := [][]byte{[]byte{0}, []byte{0}}
+	c.Update(3, []byte{1}, out)
+	if LastError() == nil {
+		t.Error("Update recorded no error")
+	}
+	if !bytes.Equal(out[0], []byte{0}) || !bytes.Equal(out[1], []byte{0}) {
+		t.Error("failed Update modified out: ", out)
+	}
+
+	c.Code([][]byte{[]byte{1}, []byte{2}, []byte{3}})
+	if err := LastError(); err != nil {
+		t.Error("Code recorded error for good input: ", err)
+	}
+}
+
+func TestCodeRange(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	in := [][]byte{
+		[]byte{1, 2, 3, 4, 5, 6, 7},
+		[]byte{41, 42, 43, 44, 45, 46, 47},
+		[]byte{11, 22, 33, 44, 55, 66, 77},
+	}
+	want := c.Code(in)
+
+	got := make([][]byte, len(want))
+	for _, r := range [][2]int{{0, 3}, {3, 3}, {3, 4}, {4, 7}} {
+		part := c.CodeRange(in, r[0], r[1])
+		for k := range got {
+			got[k] = append(got[k], part[k]...)
+		}
+	}
+	for k := range want {
+		if !bytes.Equal(got[k], want[k]) {
+			t.Error(got[k], " != ", want[k])
+		}
+	}
+}
+
+func TestCodeRangePanicOnBadRange(t *testing.T) {
+	defer recoverExpected(t)
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	c.CodeRange([][]byte{[]byte{1}, []byte{2}, []byte{3}}, 0, 2) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestCodePadded(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	in := [][]byte{
+		[]byte{1, 2, 3},
+		nil,
+		[]byte{11, 22, 33, 44, 55},
+	}
+	out, n := c.CodePadded(in)
+	if n != 5 {
+		t.Fatal("n = ", n)
+	}
+	want := c.Code([][]byte{[]byte{1, 2, 3, 0, 0}, nil, in[2]})
+	for k := range want {
+		if !bytes.Equal(out[k], want[k]) {
+			t.Error(out[k], " != ", want[k])
+		}
+	}
+	if len(in[0]) != 3 {
+		t.Error("CodePadded modified its input")
+	}
+
+	if out, n := c.CodePadded([][]byte{nil, nil, {}}); n != 0 || len(out) != 2 || len(out[0]) != 0 {
+		t.Error("empty inputs: ", out, n)
+	}
+}
+
+func TestCodeSubset(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4, 5, 6})
+	in := [][]byte{
+		[]byte{1, 2, 3, 4, 5, 6, 7},
+		nil,
+		[]byte{11, 22, 33, 44, 55, 66, 77},
+	}
+	want := c.Code(in)
+
+	for k := range want {
+		if got := c.CodeOne(k, in); !bytes.Equal(got, want[k]) {
+			t.Errorf("CodeOne(%d): %v != %v", k, got, want[k])
+		}
+	}
+	idxs := []int{3, 1, 3}
+	got := c.CodeSubset(idxs, in)
+	for j, k := range idxs {
+		if !bytes.Equal(got[j], want[k]) {
+			t.Errorf("CodeSubset output %d: %v != %v", j, got[j], want[k])
+		}
+	}
+}
+
+func TestCodeOnePanicOnBadIndex(t *testing.T) {
+	defer recoverExpected(t)
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	c.CodeOne(2, [][]byte{[]byte{1}, []byte{2}, []byte{3}}) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestCodeNilInputs(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2, 3}, []byte{4, 5})
+	in := [][]byte{nil, []byte{1, 2, 3}, nil, []byte{4, 5, 6}}
+	zeros := [][]byte{make([]byte, 3), in[1], make([]byte, 3), in[3]}
+
+	want := c.Code(zeros)
+	for name, out := range map[string][][]byte{
+		"Code":         c.Code(in),
+		"CodeRange":    c.CodeRange(in, 0, 3),
+		"CodeByOutput": c.CodeByOutput(in, 2),
+	} {
+		for k := range want {
+			if !bytes.Equal(out[k], want[k]) {
+				t.Errorf("%s: %v != %v", name, out[k], want[k])
+			}
+		}
+	}
+
+	// All nil is a stripe of empty blocks.
+	out := c.Code(make([][]byte, 4))
+	if len(out) != 2 || len(out[0]) != 0 || len(out[1]) != 0 {
+		t.Error("Code of all nil inputs: ", out)
+	}
+}
+
+func TestCodePanicOnRaggedNilInput(t *testing.T) {
+	defer recoverExpected(t)
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{0, 1, 2, 3, 4})
+	c.Code([][]byte{nil, []byte{1, 2}, []byte{1}}) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestDetectPolynomial(t *testing.T) {
+	cp, err := DetectPolynomial(exp[:], log[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp != 0x11D {
+		t.Errorf("DetectPolynomial = %#x, want 0x11D", cp)
+	}
+
+	// Tables for x^8 + x^4 + x^3 + x + 1 (0x11B) with generator 3.
+	var e [255]byte
+	var l [256]byte
+	a := byte(1)
+	for i := range e {
+		e[i] = a
+		l[a] = byte(i)
+		a = poly_multiply(a, 3, 0x11B)
+	}
+	if cp, err := DetectPolynomial(e[:], l[:]); cp != 0x11B || err != nil {
+		t.Errorf("DetectPolynomial = %#x, %v, want 0x11B", cp, err)
+	}
+
+	e[7], e[8] = e[8], e[7]
+	if _, err := DetectPolynomial(e[:], l[:]); err == nil {
+		t.Error("DetectPolynomial accepted inconsistent tables")
+	}
+}
+
+// The largest index mult computes into exp[] is for log[a] + log[b] ==
+// 254 + 254, i.e. a == b == exp[254].
+func TestMultExtremal(t *testing.T) {
+	a := exp[254]
+	if log[a] != 254 {
+		t.Fatalf("log[exp[254]] = %d", log[a])
+	}
+	if got, want := mult(a, a), galois_multiply(a, a); got != want {
+		t.Errorf("mult(%d, %d) = %d, want %d", a, a, got, want)
+	}
+}
+
+// mult must agree with galois_multiply over the whole field: zero
+// times anything is zero, which the log tables can't express, and
+// otherwise the product modulo the field polynomial.
+func TestMultConsistency(t *testing.T) {
+	for a := 0; a < 256; a++ {
+		if got := mult(uint8(a), 0); got != 0 {
+			t.Errorf("mult(%d, 0) = %d, want 0", a, got)
+		}
+		if got := mult(0, uint8(a)); got != 0 {
+			t.Errorf("mult(0, %d) = %d, want 0", a, got)
+		}
+	}
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			if got, want := mult(uint8(a), uint8(b)), galois_multiply(uint8(a), uint8(b)); got != want {
+				t.Fatalf("mult(%d, %d) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	in := [][]byte{
+		[]byte{1, 2, 3, 4, 5},
+		[]byte{41, 42, 43, 44, 45},
+		[]byte{11, 22, 33, 44, 55},
+	}
+	parity := c.Code(in)
+
+	diff, clean := c.Diff(in, parity)
+	if !clean {
+		t.Error("Diff of consistent stripe not clean: ", diff)
+	}
+
+	// A single flipped byte shows up as exactly that byte.
+	parity[1][3] ^= 0x10
+	diff, clean = c.Diff(in, parity)
+	if clean {
+		t.Error("Diff missed single byte corruption")
+	}
+	want := [][]byte{[]byte{0, 0, 0, 0, 0}, []byte{0, 0, 0, 0x10, 0}}
+	for k := range want {
+		if !bytes.Equal(diff[k], want[k]) {
+			t.Error(diff[k], " != ", want[k])
+		}
+	}
+	parity[1][3] ^= 0x10
+
+	// A wholesale bad shard is dense.
+	parity[0] = []byte{0, 0, 0, 0, 0}
+	diff, clean = c.Diff(in, parity)
+	if clean {
+		t.Error("Diff missed whole shard corruption")
+	}
+	for j, v := range diff[0] {
+		if v == 0 {
+			t.Errorf("diff[0][%d] is zero for a zeroed shard", j)
+		}
+	}
+	if !bytes.Equal(diff[1], []byte{0, 0, 0, 0, 0}) {
+		t.Error("intact shard has nonzero diff: ", diff[1])
+	}
+}
+
+func TestMulAddTable(t *testing.T) {
+	src := make([]byte, 256)
+	for i := range src {
+		src[i] = byte(i)
+	}
+	var tbl [256]byte
+	for c := 0; c < 256; c++ {
+		mulTable(byte(c), &tbl)
+		dst := make([]byte, 257)
+		dst[256] = 42
+		mulAddTable(dst, src, &tbl)
+		for i, v := range src {
+			if dst[i] != galois_multiply(v, byte(c)) {
+				t.Fatalf("%d * %d = %d, want %d", v, c, dst[i], galois_multiply(v, byte(c)))
+			}
+		}
+		if dst[256] != 42 {
+			t.Fatal("mulAddTable wrote past len(src)")
+		}
+	}
+}
+
+func BenchmarkMulAdd(b *testing.B) {
+	const n = 128 << 10
+	src, dst := make([]byte, n), make([]byte, n)
+	for i := range src {
+		src[i] = byte(i * 7)
+	}
+
+	b.Run("mult", func(b *testing.B) {
+		b.SetBytes(n)
+		for i := 0; i < b.N; i++ {
+			for j := range src {
+				dst[j] ^= mult(src[j], 0x8e)
+			}
+		}
+	})
+	b.Run("table", func(b *testing.B) {
+		b.SetBytes(n)
+		var tbl [256]byte
+		for i := 0; i < b.N; i++ {
+			mulTable(0x8e, &tbl)
+			mulAddTable(dst, src, &tbl)
+		}
+	})
+}
+
+func TestCodeFixed(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	in := [][]byte{
+		[]byte{1, 2, 3, 4, 5},
+		[]byte{41, 42, 43, 44, 45},
+		[]byte{11, 22, 33, 44, 55},
+	}
+	var buf [2][5]byte
+	out := [][]byte{buf[0][:], buf[1][:]}
+	buf[1][2] = 99 // garbage from an earlier use
+
+	want := c.Code(in)
+	c.CodeFixed(in, out)
+	for k := range want {
+		if !bytes.Equal(out[k], want[k]) {
+			t.Error(out[k], " != ", want[k])
+		}
+	}
+
+	if n := testing.AllocsPerRun(100, func() { c.CodeFixed(in, out) }); n != 0 {
+		t.Error("CodeFixed allocated ", n, " times")
+	}
+}
+
+func TestCodeFixedPanicOnBadOutput(t *testing.T) {
+	defer recoverExpected(t)
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	in := [][]byte{[]byte{1, 2}, []byte{3, 4}, []byte{5, 6}}
+	c.CodeFixed(in, [][]byte{[]byte{0, 0}, []byte{0}}) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestCodeFixedCRC(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{0, 3, 4})
+	in := [][]byte{
+		[]byte{1, 2, 3, 4, 5},
+		nil,
+		[]byte{11, 22, 33, 44, 55},
+	}
+	out := makeMatrix(3, 5)
+	crcs := make([]uint32, 3)
+	c.CodeFixedCRC(in, out, crcs)
+
+	want := c.Code(in)
+	tab := crc32.MakeTable(crc32.Castagnoli)
+	for k := range want {
+		if !bytes.Equal(out[k], want[k]) {
+			t.Error(out[k], " != ", want[k])
+		}
+		if crc := crc32.Checksum(want[k], tab); crcs[k] != crc {
+			t.Errorf("crc[%d] = %08x, want %08x", k, crcs[k], crc)
+		}
+	}
+}
+
+func TestAffectedOutputs(t *testing.T) {
+	// Systematic: input 1 is only copied to output 1, but feeds all parity.
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{0, 1, 2, 3, 4})
+	got := c.AffectedOutputs(1)
+	want := []int{1, 3, 4}
+	if len(got) != len(want) {
+		t.Fatal(got, " != ", want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatal(got, " != ", want)
+		}
+	}
+}
+
+func TestAffectedOutputsPanicOnBadIndex(t *testing.T) {
+	defer recoverExpected(t)
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	c.AffectedOutputs(3) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestMatrixIsCopy(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	in := [][]byte{[]byte{1, 2}, []byte{3, 4}, []byte{5, 6}}
+	want := c.Code(in)
+
+	m := c.Matrix()
+	if len(m) != 3 || len(m[0]) != 2 {
+		t.Fatalf("Matrix is %dx%d, want 3x2", len(m), len(m[0]))
+	}
+	m[0][0] ^= 0xff
+	for k, row := range c.Code(in) {
+		if !bytes.Equal(row, want[k]) {
+			t.Error("modifying Matrix() changed the coder")
+		}
+	}
+}
+
+func TestAbscissae(t *testing.T) {
+	in_x, out_x := []byte{0, 1, 2}, []byte{3, 4}
+	c := NewErasureCoder(in_x, out_x)
+	in_x[0], out_x[0] = 9, 9
+	if x := c.InputAbscissae(); !bytes.Equal(x, []byte{0, 1, 2}) {
+		t.Error("InputAbscissae: ", x)
+	}
+	x := c.OutputAbscissae()
+	if !bytes.Equal(x, []byte{3, 4}) {
+		t.Error("OutputAbscissae: ", x)
+	}
+	x[1] = 9
+	if !bytes.Equal(c.OutputAbscissae(), []byte{3, 4}) {
+		t.Error("modifying OutputAbscissae() changed the coder")
+	}
+	if x := CoderFromMatrix(c.Matrix()).InputAbscissae(); x != nil {
+		t.Error("InputAbscissae of a matrix coder: ", x)
+	}
+}
+
+func TestString(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1}, []byte{1, 2})
+	if s, want := c.String(), "ErasureCoder{degree 2, 2 outputs, in_x [0 1], out_x [1 2]}"; s != want {
+		t.Errorf("String() = %q, want %q", s, want)
+	}
+	if s, want := fmt.Sprintf("%#v", c), "rs.CoderFromMatrix([][]uint8{{0x00, 0x03}, {0x01, 0x02}})"; s != want {
+		t.Errorf("GoString() = %q, want %q", s, want)
+	}
+
+	f, _ := NewField(0x12D)
+	c = CoderFromMatrixField(f, [][]byte{{1, 2, 3}})
+	if s, want := c.String(), "ErasureCoder{degree 1, 3 outputs, field 0x12d}"; s != want {
+		t.Errorf("String() = %q, want %q", s, want)
+	}
+}
+
+func TestClone(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4}).WithStrategy(ProductTable)
+	d := c.Clone()
+	if d.String() != c.String() || d.GoString() != c.GoString() || d.Strategy() != ProductTable {
+		t.Errorf("Clone: %v %v, want %v %v", d, d.Strategy(), c, c.Strategy())
+	}
+	d.interp[0][0] ^= 1
+	d.in_x[0] = 7
+	if c.interp[0][0] == d.interp[0][0] || c.in_x[0] == 7 {
+		t.Error("Clone shares state with the original")
+	}
+
+	in := [][]byte{[]byte{1, 2}, []byte{3, 4}, []byte{5, 6}}
+	if &c.CodeReuse(in)[0][0] == &c.Clone().CodeReuse(in)[0][0] {
+		t.Error("Clone shares the CodeReuse buffer")
+	}
+}
+
+func TestCoderFromMatrix(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	in := [][]byte{[]byte{1, 2}, []byte{3, 4}, []byte{5, 6}}
+	want := c.Code(in)
+
+	m := c.Matrix()
+	c2 := CoderFromMatrix(m)
+	m[0][0] ^= 0xff
+	for k, row := range c2.Code(in) {
+		if !bytes.Equal(row, want[k]) {
+			t.Error(row, " != ", want[k])
+		}
+	}
+
+	f, _ := NewField(0x12D)
+	c = NewErasureCoderField(f, []byte{10, 20}, []byte{30})
+	if !bytes.Equal(CoderFromMatrixField(f, c.Matrix()).Code(in[:2])[0], c.Code(in[:2])[0]) {
+		t.Error("CoderFromMatrixField differs from the original coder")
+	}
+}
+
+func TestCoderFromMatrixPanicOnRaggedMatrix(t *testing.T) {
+	defer recoverExpected(t)
+	CoderFromMatrix([][]byte{{1, 2}, {3}}) // should panic
+	t.Error("Failed to panic")
+}
+
+// Run with -race.
+func TestConcurrentCode(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2, 3}, []byte{4, 5, 6})
+	in := randomMatrix(4, 4096, 3)
+	want := c.Code(in)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 10; n++ {
+				for k, row := range c.Code(in) {
+					if !bytes.Equal(row, want[k]) {
+						t.Error("concurrent Code returned a different result")
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestEncodeAll(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	data := [][]byte{
+		[]byte{1, 2, 3, 4, 5},
+		[]byte{41, 42, 43, 44, 45},
+		[]byte{11, 22, 33, 44, 55},
+	}
+	shards := c.EncodeAll(data)
+	if len(shards) != 5 {
+		t.Fatal(len(shards), " shards, want 5")
+	}
+	for i := range data {
+		if &shards[i][0] != &data[i][0] || len(shards[i]) != len(data[i]) {
+			t.Errorf("shard %d is not data[%d]", i, i)
+		}
+	}
+	parity := c.Code(data)
+	for k := range parity {
+		if !bytes.Equal(shards[3+k], parity[k]) {
+			t.Error(shards[3+k], " != ", parity[k])
+		}
+	}
+	if !c.QuickCheck(shards) {
+		t.Error("EncodeAll output fails QuickCheck")
+	}
+}
+
+func TestNewErasureCoderPanicOnDuplicateAbscissa(t *testing.T) {
+	defer func() {
+		e, ok := recover().(error)
+		if !ok {
+			t.Fatal("Failed to panic")
+		}
+		if e.Error() != "Abscissa 3 appears twice in in_x" {
+			t.Error("wrong message: ", e)
+		}
+	}()
+	NewErasureCoder([]byte{0, 3, 1, 3}, []byte{4, 5}) // should panic
+}
+
+func TestNewErasureCoderPanicOnBadAbscissae(t *testing.T) {
+	many := make([]byte, 257)
+	for _, c := range []struct {
+		in_x, out_x []byte
+		msg         string
+	}{
+		{nil, []byte{1}, "No abscissae in in_x"},
+		{[]byte{0, 1}, []byte{2, 3, 2}, "Abscissa 2 appears twice in out_x"},
+		{many, []byte{1}, "Too many abscissae in in_x: 257, GF(2^8) has only 256"},
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("NewErasureCoder(%v, %v) did not panic", c.in_x, c.out_x)
+				} else if err, ok := r.(error); !ok || err.Error() != c.msg {
+					t.Errorf("panicked with %v, want %q", r, c.msg)
+				}
+			}()
+			NewErasureCoder(c.in_x, c.out_x)
+		}()
+	}
+
+	// Outputs may be at input abscissae.
+	NewErasureCoder([]byte{0, 1}, []byte{1, 0, 2})
+}
+
+func TestDivPanicOnZero(t *testing.T) {
+	defer recoverExpected(t)
+	div(1, 0) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestCodeInto(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	out := makeMatrix(2, 100)
+	for n := 0; n < 3; n++ {
+		in := randomMatrix(3, 100, byte(n))
+		c.CodeInto(in, out)
+		want := c.Code(in)
+		for k := range want {
+			if !bytes.Equal(out[k], want[k]) {
+				t.Errorf("block %d: output %d differs", n, k)
+			}
+		}
+	}
+}
+
+func TestCodeIntoPanicOnBadOutput(t *testing.T) {
+	defer recoverExpected(t)
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	in := [][]byte{[]byte{1, 2}, []byte{3, 4}, []byte{5, 6}}
+	c.CodeInto(in, [][]byte{[]byte{0, 0}}) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestRaggedErrorLengths(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2, 3}, []byte{4})
+	_, err := c.CodeErr([][]byte{make([]byte, 5), nil, make([]byte, 4), make([]byte, 5)})
+	if err == nil || !strings.HasSuffix(err.Error(), "row lengths [5 nil 4 5]") {
+		t.Error("CodeErr: ", err)
+	}
+	err = c.UpdateErr(1, make([]byte, 5), [][]byte{make([]byte, 3)})
+	if err == nil || !strings.HasSuffix(err.Error(), "out row lengths [3]") {
+		t.Error("UpdateErr: ", err)
+	}
+}
+
+func TestCodeErr(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	if _, err := c.CodeErr([][]byte{[]byte{1}}); err == nil {
+		t.Error("CodeErr accepted wrong number of inputs")
+	}
+	if _, err := c.CodeErr([][]byte{[]byte{1, 2}, []byte{1}, []byte{1}}); err == nil {
+		t.Error("CodeErr accepted ragged inputs")
+	}
+
+	in := [][]byte{[]byte{1, 2}, []byte{3, 4}, []byte{5, 6}}
+	out, err := c.CodeErr(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := c.Code(in)
+	for k := range want {
+		if !bytes.Equal(out[k], want[k]) {
+			t.Error(out[k], " != ", want[k])
+		}
+	}
+}
+
+func TestUpdateErr(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	out := [][]byte{[]byte{0}, []byte{0}}
+	if err := c.UpdateErr(3, []byte{1}, out); err == nil {
+		t.Error("UpdateErr accepted index out of range")
+	}
+	if err := c.UpdateErr(0, []byte{1}, out[:1]); err == nil {
+		t.Error("UpdateErr accepted wrong number of outputs")
+	}
+	if err := c.UpdateErr(0, []byte{1, 2}, out); err == nil {
+		t.Error("UpdateErr accepted ragged delta")
+	}
+	if err := c.UpdateErr(0, []byte{1}, out); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateIndexBounds(t *testing.T) {
+	c := NewErasureCoder([]byte{10, 20, 30}, []byte{3, 4})
+	out := [][]byte{[]byte{0}, []byte{0}}
+	if err := c.UpdateErr(uint8(c.Degree()-1), []byte{1}, out); err != nil {
+		t.Error("index Degree()-1: ", err)
+	}
+	if err := c.UpdateErr(uint8(c.Degree()), []byte{1}, out); err == nil {
+		t.Error("UpdateErr accepted index Degree()")
+	}
+	// An abscissa is not an index.
+	if err := c.UpdateErr(20, []byte{1}, out); err == nil {
+		t.Error("UpdateErr accepted abscissa 20 as an index")
+	}
+
+	// With 256 inputs every idx is in range, Degree() doesn't fit in a byte.
+	m := makeMatrix(256, 1)
+	for i := range m {
+		m[i][0] = 1
+	}
+	c = CoderFromMatrix(m)
+	out = [][]byte{[]byte{0}}
+	for _, idx := range []uint8{0, 255} {
+		if err := c.UpdateErr(idx, []byte{1}, out); err != nil {
+			t.Errorf("degree 256, index %d: %v", idx, err)
+		}
+	}
+	if out[0][0] != 0 {
+		t.Error("two updates with 1 did not cancel: ", out[0][0])
+	}
+}
+
+func TestUpdateMulti(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2, 3}, []byte{4, 5, 6})
+	data := randomMatrix(4, 64, 11)
+	out := c.Code(data)
+
+	idxs := []byte{3, 0, 3}
+	deltas := randomMatrix(3, 64, 12)
+	c.UpdateMulti(idxs, deltas, out)
+	for j, i := range idxs {
+		for n, v := range deltas[j] {
+			data[i][n] ^= v
+		}
+	}
+	for k, row := range c.Code(data) {
+		if !bytes.Equal(out[k], row) {
+			t.Errorf("output %d wrong after UpdateMulti", k)
+		}
+	}
+}
+
+func TestUpdateMultiPanicOnRaggedDelta(t *testing.T) {
+	defer recoverExpected(t)
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	out := [][]byte{[]byte{0, 0}, []byte{0, 0}}
+	c.UpdateMulti([]byte{0, 1}, [][]byte{[]byte{1, 2}, []byte{1}}, out) // should panic
+	t.Error("Failed to panic")
+}
+
+// Encode random data with random k and m at random abscissae, erase m
+// random shards and reconstruct them from the rest.
+func TestRandomRoundTrip(t *testing.T) {
+	const seed = 20111017
+	rnd := rand.New(rand.NewSource(seed))
+	for iter := 0; iter < 200; iter++ {
+		k := 1 + rnd.Intn(20)
+		m := rnd.Intn(20)
+		n := []int{0, 1, 2, 63, 64, 65, 1000}[rnd.Intn(7)]
+
+		xs := rnd.Perm(256)[:k+m]
+		all_x := make([]byte, k+m)
+		for i, x := range xs {
+			all_x[i] = byte(x)
+		}
+		data := make([][]byte, k)
+		for i := range data {
+			data[i] = make([]byte, n)
+			rnd.Read(data[i])
+		}
+		shards := append(append([][]byte(nil), data...), NewErasureCoder(all_x[:k], all_x[k:]).Code(data)...)
+
+		lost := rnd.Perm(k + m)[:m]
+		var is_lost [256]bool
+		var lost_x []byte
+		for _, i := range lost {
+			is_lost[i] = true
+			lost_x = append(lost_x, all_x[i])
+		}
+		var have_x []byte
+		var have [][]byte
+		for i := range shards {
+			if !is_lost[i] {
+				have_x = append(have_x, all_x[i])
+				have = append(have, shards[i])
+			}
+		}
+
+		rec := NewErasureCoder(have_x, lost_x).Code(have)
+		for j, i := range lost {
+			if !bytes.Equal(rec[j], shards[i]) {
+				t.Fatalf("seed %d, iteration %d: k=%d m=%d n=%d, abscissae %v, lost %v: shard %d not recovered", seed, iter, k, m, n, all_x, lost, i)
+			}
+		}
+	}
+}
+
+func TestZeroLength(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	for _, in := range [][][]byte{
+		{{}, {}, {}},
+		{nil, nil, nil},
+		{nil, {}, nil},
+	} {
+		out := c.Code(in)
+		if len(out) != 2 {
+			t.Fatalf("Code(%v) returned %d outputs", in, len(out))
+		}
+		for k, row := range out {
+			if row == nil || len(row) != 0 {
+				t.Errorf("Code(%v): output %d is %v, want empty", in, k, row)
+			}
+		}
+		if out, n := c.CodePadded(in); n != 0 || len(out) != 2 {
+			t.Errorf("CodePadded(%v) = %v, %d", in, out, n)
+		}
+		if !c.QuickCheck(append(in, out...)) {
+			t.Errorf("QuickCheck of an empty stripe failed")
+		}
+	}
+
+	out := [][]byte{{}, {}}
+	c.Update(1, []byte{}, out)
+	c.UpdateMulti([]byte{0, 2}, [][]byte{{}, nil}, out)
+	if len(out[0]) != 0 || len(out[1]) != 0 {
+		t.Error("Update with an empty delta changed the outputs")
+	}
+	c.CodeInto([][]byte{{}, {}, {}}, out)
+}
+
+func TestLagrangeFactor(t *testing.T) {
+	in_x, out_x := []byte{3, 7, 9, 200}, []byte{0, 3, 100}
+	m := NewErasureCoder(in_x, out_x).Matrix()
+	for i := range in_x {
+		for j, x := range out_x {
+			if f := LagrangeFactor(in_x, i, x); f != m[i][j] {
+				t.Errorf("LagrangeFactor(%v, %d, %d) = %d, Matrix has %d", in_x, i, x, f, m[i][j])
+			}
+		}
+	}
+	// At the abscissae themselves, the basis polynomials are 1 or 0.
+	for i := range in_x {
+		for k, x := range in_x {
+			if f := LagrangeFactor(in_x, i, x); (f == 1) != (i == k) || f > 1 {
+				t.Errorf("LagrangeFactor(%v, %d, %d) = %d", in_x, i, x, f)
+			}
+		}
+	}
+	f, _ := NewField(0x12D)
+	if got, want := f.LagrangeFactor(in_x, 1, 100), NewErasureCoderField(f, in_x, out_x).Matrix()[1][2]; got != want {
+		t.Errorf("Field.LagrangeFactor: %d != %d", got, want)
+	}
+}
+
+func TestLagrangeFactorPanicOnIndex(t *testing.T) {
+	defer recoverExpected(t)
+	LagrangeFactor([]byte{1, 2}, 2, 5) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestLagrangeFactorPanicOnDuplicates(t *testing.T) {
+	defer recoverExpected(t)
+	LagrangeFactor([]byte{1, 2, 1}, 0, 5) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestWithExtraOutputs(t *testing.T) {
+	f, _ := NewField(0x12D)
+	for _, c := range []*ErasureCoder{
+		NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4}),
+		NewErasureCoderField(f, []byte{0, 1, 2}, []byte{3, 4}),
+	} {
+		in := randomMatrix(3, 100, 6)
+		old := c.Code(in)
+		ext := c.WithExtraOutputs([]byte{5, 9})
+		if !bytes.Equal(ext.OutputAbscissae(), []byte{3, 4, 5, 9}) || c.NumOutputs() != 2 {
+			t.Fatal("outputs: ", ext.OutputAbscissae(), c.NumOutputs())
+		}
+		want := NewErasureCoderField(c.field, []byte{0, 1, 2}, []byte{3, 4, 5, 9}).Code(in)
+		out := ext.Code(in)
+		for k := range want {
+			if !bytes.Equal(out[k], want[k]) {
+				t.Errorf("output %d differs", k)
+			}
+		}
+		for k := range old {
+			if !bytes.Equal(out[k], old[k]) {
+				t.Errorf("existing output %d changed", k)
+			}
+		}
+	}
+}
+
+func TestWithExtraOutputsKeepsStrategy(t *testing.T) {
+	in := randomMatrix(3, 100, 7)
+	for _, st := range []Strategy{NoTables, ProductTable, CoefficientTables} {
+		c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4}).WithStrategy(st)
+		ext := c.WithExtraOutputs([]byte{5})
+		if ext.Strategy() != st {
+			t.Errorf("%s became %s", st, ext.Strategy())
+		}
+		want := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4, 5}).Code(in)
+		out := ext.Code(in)
+		for k := range want {
+			if !bytes.Equal(out[k], want[k]) {
+				t.Errorf("%s: output %d differs", st, k)
+			}
+		}
+	}
+}
+
+func TestWithExtraOutputsPanicOnDuplicate(t *testing.T) {
+	defer recoverExpected(t)
+	NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4}).WithExtraOutputs([]byte{4}) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestWithExtraOutputsPanicOnMatrixCoder(t *testing.T) {
+	defer recoverExpected(t)
+	NewCauchyCoder(3, 2).WithExtraOutputs([]byte{9}) // should panic
+	t.Error("Failed to panic")
+}
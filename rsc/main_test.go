@@ -0,0 +1,115 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// buildRsc builds the rsc binary into a temporary directory.
+func buildRsc(t *testing.T) string {
+	if testing.Short() {
+		t.Skip("builds rsc")
+	}
+	bin := filepath.Join(t.TempDir(), "rsc")
+	out, err := exec.Command(filepath.Join(runtime.GOROOT(), "bin", "go"), "build", "-o", bin, ".").CombinedOutput()
+	if err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	return bin
+}
+
+func TestRoundTrip(t *testing.T) {
+	bin := buildRsc(t)
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	rsc := func(args ...string) {
+		if out, err := exec.Command(bin, args...).CombinedOutput(); err != nil {
+			t.Fatalf("rsc %v: %v\n%s", args, err, out)
+		}
+	}
+
+	// Lengths that aren't multiples of the block size, nor equal.
+	data := [][]byte{randomBytes(3*1024+17, 1), randomBytes(1000, 2), randomBytes(1, 3)}
+	for i, d := range data {
+		if err := os.WriteFile(path("foo"+string('0'+rune(i))), d, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rsc("-b", "1k", "-wtoc", path("foo.toc"), "-i", "0,1,2", path("foo0"), path("foo1"), path("foo2"),
+		"-o", "3,4,5", path("foo.rs3"), path("foo.rs4"), path("foo.rs5"))
+
+	// Lose originals 0 and 2, recover them from 1 and two parity shards.
+	for _, j := range []string{"1", "2"} {
+		rsc("-b", "1k", "-j", j, "-rtoc", path("foo.toc"), "-i", "1,3,5", path("foo1"), path("foo.rs3"), path("foo.rs5"),
+			"-o", "0,2", path("bar0"), path("bar2"))
+		for _, i := range []int{0, 2} {
+			got, err := os.ReadFile(path("bar" + string('0'+rune(i))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data[i]) {
+				t.Errorf("-j %s: original %d is %d bytes and differs, want %d bytes", j, i, len(got), len(data[i]))
+			}
+		}
+	}
+}
+
+// The older form, all flags first and then the files, inputs first.
+func TestFlagsFirst(t *testing.T) {
+	bin := buildRsc(t)
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	data := [][]byte{randomBytes(2000, 4), randomBytes(1500, 5)}
+	for i, d := range data {
+		if err := os.WriteFile(path("foo"+string('0'+rune(i))), d, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"-i", "0,1", "-o", "2", path("foo0"), path("foo1"), path("foo.rs2")},
+		{"-i", "1,2", "-o", "0", path("foo1"), path("foo.rs2"), path("bar0")},
+	} {
+		if out, err := exec.Command(bin, args...).CombinedOutput(); err != nil {
+			t.Fatalf("rsc %v: %v\n%s", args, err, out)
+		}
+	}
+	got, err := os.ReadFile(path("bar0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got[:len(data[0])], data[0]) {
+		t.Error("original 0 not recovered")
+	}
+}
+
+func TestCheckTruncated(t *testing.T) {
+	var b bytes.Buffer
+	w := &truncWriter{&b, 10}
+	w.Write(make([]byte, 7))
+	if err := checkTruncated([]io.Writer{&b, w}, []string{"a", "b"}); err == nil {
+		t.Error("checkTruncated accepted a short output")
+	}
+	w.Write(make([]byte, 7))
+	if err := checkTruncated([]io.Writer{&b, w}, []string{"a", "b"}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/lvdlvd/go-encoding-rs"
+	"io"
+)
+
+// A block of the inputs and outputs in flight through the pipeline.
+type block struct {
+	in, out [][]byte
+	done    chan struct{} // signalled when out has been computed
+}
+
+// pipeline is the parallel equivalent of rs.StreamCoder.Run: a reader
+// goroutine reads blocks with a StreamCoder, jobs goroutines code them,
+// and the calling goroutine writes the outputs in the order the blocks
+// were read.  At most 2*jobs blocks are in flight, and their buffers
+// are recycled.  It returns the number of bytes read from each input.
+func pipeline(coder *rs.ErasureCoder, readers []io.Reader, writers []io.Writer, block_size, jobs int) ([]int64, error) {
+	s, err := rs.NewStreamCoder(coder, readers, writers, block_size)
+	if err != nil {
+		return nil, err
+	}
+	free := make(chan *block, 2*jobs)
+	for i := 0; i < cap(free); i++ {
+		in, out := s.NewBlock()
+		free <- &block{in: in, out: out, done: make(chan struct{}, 1)}
+	}
+	work := make(chan *block)
+	order := make(chan *block, cap(free)) // never blocks, holds at most all blocks
+	quit := make(chan struct{})
+
+	var read_err error
+	go func() {
+		defer close(order)
+		defer close(work)
+		for {
+			var b *block
+			select {
+			case b = <-free:
+			case <-quit:
+				return
+			}
+
+			n, err := s.ReadBlock(b.in)
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				read_err = err
+				return
+			}
+			for k := range b.out {
+				b.out[k] = b.out[k][:n]
+			}
+			order <- b
+			select {
+			case work <- b:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	for j := 0; j < jobs; j++ {
+		go func() {
+			for b := range work {
+				coder.CodeInto(b.in, b.out)
+				b.done <- struct{}{}
+			}
+		}()
+	}
+
+	for b := range order {
+		<-b.done
+		for k, w := range writers {
+			if _, err := w.Write(b.out[k]); err != nil {
+				close(quit)
+				for range order {
+				}
+				return nil, err
+			}
+		}
+		free <- b
+	}
+	// order is closed after the reader set read_err.
+	if read_err != nil {
+		return nil, read_err
+	}
+	return s.BytesRead(), nil
+}
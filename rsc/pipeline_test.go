@@ -0,0 +1,98 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/lvdlvd/go-encoding-rs"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func randomBytes(n int, seed int64) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func TestPipeline(t *testing.T) {
+	coder := rs.NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	for _, lens := range [][]int{{0, 0, 0}, {1000, 1000, 1000}, {1024, 0, 333}, {5, 4000, 1}} {
+		data := [][]byte{randomBytes(lens[0], 1), randomBytes(lens[1], 2), randomBytes(lens[2], 3)}
+		readers := func() []io.Reader {
+			return []io.Reader{bytes.NewReader(data[0]), bytes.NewReader(data[1]), bytes.NewReader(data[2])}
+		}
+
+		var want [2]bytes.Buffer
+		s, _ := rs.NewStreamCoder(coder, readers(), []io.Writer{&want[0], &want[1]}, 256)
+		if err := s.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, jobs := range []int{1, 2, 5} {
+			var got [2]bytes.Buffer
+			read, err := pipeline(coder, readers(), []io.Writer{&got[0], &got[1]}, 256, jobs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(read, s.BytesRead()) {
+				t.Errorf("lengths %v, %d jobs: read %v", lens, jobs, read)
+			}
+			for k := range got {
+				if !bytes.Equal(got[k].Bytes(), want[k].Bytes()) {
+					t.Errorf("lengths %v, %d jobs: output %d differs", lens, jobs, k)
+				}
+			}
+		}
+	}
+}
+
+type failWriter struct{ n int }
+
+func (w *failWriter) Write(b []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("disk full")
+	}
+	w.n--
+	return len(b), nil
+}
+
+type failReader struct{ r io.Reader }
+
+func (f failReader) Read(b []byte) (int, error) {
+	n, err := f.r.Read(b)
+	if err == io.EOF {
+		return n, errors.New("bad sector")
+	}
+	return n, err
+}
+
+func TestPipelineErrors(t *testing.T) {
+	coder := rs.NewErasureCoder([]byte{0, 1}, []byte{2})
+	data := randomBytes(10000, 4)
+
+	_, err := pipeline(coder, []io.Reader{bytes.NewReader(data), bytes.NewReader(data)}, []io.Writer{&failWriter{n: 3}}, 100, 3)
+	if err == nil || err.Error() != "disk full" {
+		t.Error("write error: ", err)
+	}
+
+	_, err = pipeline(coder, []io.Reader{bytes.NewReader(data), failReader{bytes.NewReader(data[:950])}}, []io.Writer{io.Discard}, 100, 3)
+	if err == nil || err.Error() != "bad sector" {
+		t.Error("read error: ", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// A plan is what rsc would do with inputs of the given sizes, for -plan.
+type plan struct {
+	longest int64   // the size of the longest input, and of every output
+	blocks  int64   // the number of blocks coded
+	padding []int64 // the zero bytes added to each input
+	memory  int64   // the buffers allocated, in bytes
+}
+
+// makePlan works out the plan for inputs of the given sizes, n_out
+// outputs, and the block size and -j.
+func makePlan(sizes []int64, n_out, block_size, jobs int) *plan {
+	p := &plan{padding: make([]int64, len(sizes))}
+	for _, n := range sizes {
+		if p.longest < n {
+			p.longest = n
+		}
+	}
+	p.blocks = (p.longest + int64(block_size) - 1) / int64(block_size)
+	for i, n := range sizes {
+		p.padding[i] = p.longest - n
+	}
+	// One buffer per input and output, or 2*jobs of them in the pipeline.
+	in_flight := int64(1)
+	if jobs > 1 {
+		in_flight = 2 * int64(jobs)
+	}
+	p.memory = in_flight * int64(len(sizes)+n_out) * int64(block_size)
+	return p
+}
+
+// fileSizes returns the sizes of the named files, or an error if one
+// of them is not a regular file, whose size can't be known in advance.
+func fileSizes(names []string) ([]int64, error) {
+	sizes := make([]int64, len(names))
+	for i, name := range names {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s is not a regular file, its size is unknown", name)
+		}
+		sizes[i] = fi.Size()
+	}
+	return sizes, nil
+}
+
+// print writes the plan for the named inputs and outputs to w.  The
+// lengths of the outputs are those of the plan, except for those in
+// truncated, e.g. from a table of contents.
+func (p *plan) print(w io.Writer, block_size *sizeFlag, jobs int, in_names, out_names []string, truncated map[int]int64) {
+	fmt.Fprintf(w, "blocks: %d of %s bytes\n", p.blocks, block_size)
+	for i, name := range in_names {
+		fmt.Fprintf(w, "input %s: %d bytes, padded with %d zero bytes\n", name, p.longest-p.padding[i], p.padding[i])
+	}
+	var total int64
+	for k, name := range out_names {
+		n := p.longest
+		if t, ok := truncated[k]; ok && t < n {
+			n = t
+		}
+		total += n
+		fmt.Fprintf(w, "output %s: %d bytes\n", name, n)
+	}
+	fmt.Fprintf(w, "total output: %d bytes\n", total)
+	fmt.Fprintf(w, "memory: %d bytes of buffers with -j %d\n", p.memory, jobs)
+}
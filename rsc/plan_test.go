@@ -0,0 +1,63 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMakePlan(t *testing.T) {
+	p := makePlan([]int64{1000, 2049, 0}, 2, 1024, 1)
+	want := &plan{longest: 2049, blocks: 3, padding: []int64{1049, 0, 2049}, memory: 5 * 1024}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("plan %+v, want %+v", p, want)
+	}
+	if p := makePlan([]int64{1000, 2049, 0}, 2, 1024, 4); p.memory != 8*5*1024 {
+		t.Error("memory with -j 4: ", p.memory)
+	}
+	if p := makePlan([]int64{0, 0}, 1, 1024, 1); p.blocks != 0 {
+		t.Error("blocks of empty inputs: ", p.blocks)
+	}
+
+	var b bytes.Buffer
+	bs := sizeFlag{1024}
+	p.print(&b, &bs, 1, []string{"a", "b", "c"}, []string{"x", "y"}, map[int]int64{1: 100})
+	for _, line := range []string{
+		"blocks: 3 of 1k bytes",
+		"input a: 1000 bytes, padded with 1049 zero bytes",
+		"output x: 2049 bytes",
+		"output y: 100 bytes",
+		"total output: 2149 bytes",
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("no %q in\n%s", line, b.String())
+		}
+	}
+}
+
+func TestFileSizes(t *testing.T) {
+	files := openFiles(t, t.TempDir(), 10, 0)
+	sizes, err := fileSizes([]string{files[0].Name(), files[1].Name()})
+	if err != nil || !reflect.DeepEqual(sizes, []int64{10, 0}) {
+		t.Error("fileSizes: ", sizes, err)
+	}
+	if _, err := fileSizes([]string{filepath.Dir(files[0].Name())}); err == nil {
+		t.Error("fileSizes accepted a directory")
+	}
+}
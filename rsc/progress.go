@@ -0,0 +1,133 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// A progress counts the bytes read from the inputs and reports them
+// periodically, for -progress.
+type progress struct {
+	w     io.Writer
+	tty   bool  // update a single line in place
+	total int64 // of all inputs, or -1 if unknown
+	done  int64 // accessed atomically
+
+	start, last time.Time
+	last_done   int64
+	stop        chan bool
+	stopped     chan bool
+}
+
+// isTerminal reports whether f is a terminal rather than a file or a
+// pipe.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// totalSize returns the sum of the sizes of the files, or -1 if they
+// are not all regular files.
+func totalSize(files []*os.File) int64 {
+	var total int64
+	for _, f := range files {
+		fi, err := f.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			return -1
+		}
+		total += fi.Size()
+	}
+	return total
+}
+
+// A progressReader adds the bytes read from r to p.done.
+type progressReader struct {
+	r io.Reader
+	p *progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	atomic.AddInt64(&r.p.done, int64(n))
+	return n, err
+}
+
+// wrap returns the readers wrapped to count towards p.
+func (p *progress) wrap(readers []io.Reader) {
+	for i, r := range readers {
+		readers[i] = &progressReader{r, p}
+	}
+}
+
+// line formats the progress at time now.  The rate is the one since
+// the previous call.
+func (p *progress) line(now time.Time) string {
+	done := atomic.LoadInt64(&p.done)
+	var rate float64
+	if dt := now.Sub(p.last).Seconds(); dt > 0 {
+		rate = float64(done-p.last_done) / dt / 1e6
+	}
+	p.last, p.last_done = now, done
+	if p.total > 0 {
+		return fmt.Sprintf("%.1f MB of %.1f MB, %d%%, %.1f MB/s", float64(done)/1e6, float64(p.total)/1e6, done*100/p.total, rate)
+	}
+	return fmt.Sprintf("%.1f MB, %.1f MB/s", float64(done)/1e6, rate)
+}
+
+func (p *progress) print(now time.Time) {
+	if p.tty {
+		fmt.Fprintf(p.w, "\r%s\033[K", p.line(now))
+	} else {
+		fmt.Fprintln(p.w, p.line(now))
+	}
+}
+
+// Start prints the progress every interval until Stop is called.
+func (p *progress) Start(interval time.Duration) {
+	p.start = time.Now()
+	p.last = p.start
+	p.stop = make(chan bool)
+	p.stopped = make(chan bool)
+	go func() {
+		defer close(p.stopped)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case now := <-t.C:
+				p.print(now)
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic reports and prints the total and the
+// average rate.
+func (p *progress) Stop() {
+	close(p.stop)
+	<-p.stopped
+	p.last, p.last_done = p.start, 0
+	p.print(time.Now())
+	if p.tty {
+		fmt.Fprintln(p.w)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	var buf bytes.Buffer
+	p := &progress{w: &buf, total: 4e6}
+	readers := []io.Reader{bytes.NewReader(make([]byte, 3e6)), strings.NewReader("")}
+	p.wrap(readers)
+
+	p.Start(time.Hour)
+	io.Copy(io.Discard, readers[0])
+	io.Copy(io.Discard, readers[1])
+	if got := p.line(p.start.Add(2 * time.Second)); got != "3.0 MB of 4.0 MB, 75%, 1.5 MB/s" {
+		t.Error("line: ", got)
+	}
+	p.Stop()
+	if got := buf.String(); !strings.HasPrefix(got, "3.0 MB of 4.0 MB, 75%, ") || !strings.HasSuffix(got, " MB/s\n") {
+		t.Errorf("Stop printed %q", got)
+	}
+
+	p = &progress{w: &buf, total: -1, done: 5e5}
+	p.last = time.Now()
+	if got := p.line(p.last.Add(time.Second)); got != "0.5 MB, 0.5 MB/s" {
+		t.Error("line with unknown total: ", got)
+	}
+}
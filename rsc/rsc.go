@@ -26,10 +26,14 @@
  parameter to produce each of the files named as ofiles.
 
  On output all files will be padded with zero bytes to the lenght of
- the longest input file.
+ the longest input file.  When decoding from shards, which are all of
+ equal length, pass -strict to refuse inputs that are shorter than the
+ others, e.g. because a shard file was truncated.
 
- [TODO flags currently requires all flags come before all files.
-  better do my own parsing. the examples below are off.]
+ The input files follow the -i flag and the output files the -o flag,
+ and the other flags may go anywhere.  The older form with all flags
+ first, followed by the input and then the output files, is also
+ accepted, e.g. rsc -i 0,1,2 -o 3 foo0 foo1 foo2 foo.rs3.
 
  Example use:
      rsc -i 0,1,2 foo0.org foo1.org foo2.org -o 3,4,5 foo.rs3 foo.rs4 foo.rs5
@@ -42,11 +46,36 @@
      rsc -i 0,3,5 foo0.org foo.rs3 foo.rs5  -o 1 foo1.org
 
  Note that the output may be longer than the original foo1.org,
- because of padding, so you may have to keep track of the original lengths
- if your fileformat does not cope with that gracefully.  You also have
- to keep track of the order of the polynomial used, eg, the number of
- inputs, and which abscissa each file belongs to. (TODO(lvd), read/write
- a toc on stdin/out to keep track of this)
+ because of padding.  To keep track of the original lengths, and of
+ the abscissae and the number of inputs, pass -wtoc when encoding to
+ write a table of contents, and -rtoc when decoding to read it back and
+ truncate the recovered originals to their recorded lengths:
+
+     rsc -wtoc foo.toc -i 0,1,2 foo0.org foo1.org foo2.org -o 3,4,5 foo.rs3 foo.rs4 foo.rs5
+     rsc -rtoc foo.toc -i 0,3,5 foo0.org foo.rs3 foo.rs5 -o 1 foo1.org
+
+ Files are coded in blocks of 128k, or the size given with -b, e.g.
+ -b 1M.  With -j N, rsc reads, codes and writes up to 2N blocks at a time,
+ coding N of them in parallel, which helps on fast disks.  For long
+ jobs, -progress reports how far along rsc is every second.
+
+ Any one input file, and any one output file, may be given as - for
+ stdin and stdout, so rsc can be used in a pipeline, e.g.:
+
+     cat foo.rs3 | rsc -rtoc foo.toc -i 0,3,5 foo0.org - foo.rs5 -o 1 - | ...
+
+ To check that a set of shards is consistent, e.g. for bit-rot in an
+ archive, pass -verify: the files following -o are then read rather
+ than written, and compared with what the files following -i predict
+ for them.  rsc reports the first shard that differs and exits with a
+ non-zero status:
+
+     rsc -verify -i 0,1,2 foo0.org foo1.org foo2.org -o 3,4,5 foo.rs3 foo.rs4 foo.rs5
+
+ Before a big job, pass -plan to print the number of blocks, the bytes
+ each output will get, the zero padding added to each input and the
+ buffer memory for the chosen -b and -j, without coding anything.  The
+ inputs must be regular files, so their sizes are known.
 
  You can also use any 3 to construct a new one that can be used to
  decode instead of any other, e.g.:
@@ -66,10 +95,10 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
-//var kUsage = "Usage: %s -i 0,1... infile0 infile1... -o 3,4... ofile3 ofile4..."
-const kUsage = "Usage: %s -i 0,1... -o 3,4...  infile0 infile1... ofile3 ofile4...\n"
+const kUsage = "Usage: %s -i 0,1... infile0 infile1... -o 3,4... ofile3 ofile4...\n"
 
 func usage(msg ...interface{}) {
 	if len(msg) > 0 {
@@ -116,97 +145,433 @@ func (p *byteArrayFlag) Set(s string) error {
 	return nil
 }
 // -----------------------------------------------------------------------------
+//   Flag of type int, a size in bytes with an optional k, M or G suffix
+// -----------------------------------------------------------------------------
+type sizeFlag struct {
+	value int
+}
 
-func main() {
+func (p *sizeFlag) String() string {
+	switch v := p.value; {
+	case v != 0 && v%(1<<30) == 0:
+		return strconv.Itoa(v>>30) + "G"
+	case v != 0 && v%(1<<20) == 0:
+		return strconv.Itoa(v>>20) + "M"
+	case v != 0 && v%(1<<10) == 0:
+		return strconv.Itoa(v>>10) + "k"
+	}
+	return strconv.Itoa(p.value)
+}
+
+func (p *sizeFlag) Set(s string) error {
+	shift := 0
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'k', 'K':
+			shift = 10
+		case 'm', 'M':
+			shift = 20
+		case 'g', 'G':
+			shift = 30
+		}
+		if shift != 0 {
+			s = s[:n-1]
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	if v <= 0 || v > (1<<31-1)>>shift {
+		return fmt.Errorf("size out of range")
+	}
+	p.value = v << shift
+	return nil
+}
+// -----------------------------------------------------------------------------
+
+// Block sizes above this are most likely a typo.
+const kMaxSaneBlocksize = 64 << 20
+
+// A command line, as parsed by parseArgs.
+type cmdLine struct {
+	idx_in, idx_out     byteArrayFlag
+	in_names, out_names []string
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// parseArgs parses the command line args, in which the files following
+// -i, up to the next flag, are the inputs, and those following -o the
+// outputs.  If one of the two has no files, as in the older form with
+// all flags first, the files are split by the number of abscissae,
+// inputs first.  All other flags are parsed by fs.
+func parseArgs(fs *flag.FlagSet, args []string) (*cmdLine, error) {
+	c := new(cmdLine)
+	var rest []string // for fs
+	var group *[]string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "-" || !strings.HasPrefix(a, "-") {
+			if group == nil {
+				return nil, fmt.Errorf("File %s before -i or -o", a)
+			}
+			*group = append(*group, a)
+			continue
+		}
+		name, value, has_value := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		switch name {
+		case "i", "o":
+			if !has_value {
+				if i+1 == len(args) {
+					return nil, fmt.Errorf("Flag -%s needs a value", name)
+				}
+				i++
+				value = args[i]
+			}
+			f, g := &c.idx_in, &c.in_names
+			if name == "o" {
+				f, g = &c.idx_out, &c.out_names
+			}
+			if err := f.Set(value); err != nil {
+				return nil, fmt.Errorf("Bad value %q for -%s: %v", value, name, err)
+			}
+			group = g
+		default:
+			rest = append(rest, a)
+			if f := fs.Lookup(name); f != nil && !has_value && !isBoolFlag(f) && i+1 < len(args) {
+				i++
+				rest = append(rest, args[i])
+			}
+		}
+	}
+	if err := fs.Parse(rest); err != nil {
+		return nil, err
+	}
+
+	if len(c.idx_in.values) == 0 || len(c.idx_out.values) == 0 {
+		return nil, fmt.Errorf("Please specify both input and output abscissae -i <byte>,... and -o <byte>,...")
+	}
 
-	var idx_in, idx_out byteArrayFlag
+	n_in, n := len(c.idx_in.values), len(c.idx_in.values)+len(c.idx_out.values)
+	// The capacity of in_names is cut, so that appending to it can't
+	// overwrite out_names.
+	if len(c.in_names) == 0 && len(c.out_names) == n {
+		c.in_names, c.out_names = c.out_names[:n_in:n_in], c.out_names[n_in:]
+	} else if len(c.out_names) == 0 && len(c.in_names) == n {
+		c.in_names, c.out_names = c.in_names[:n_in:n_in], c.in_names[n_in:]
+	}
+
+	if len(c.in_names) != len(c.idx_in.values) || len(c.out_names) != len(c.idx_out.values) {
+		return nil, fmt.Errorf("Please specify as many input and output files as values to -i and -o.")
+	}
+	return c, nil
+}
 
-	// TODO flags currently requires all flags come before all files.  better do my own parsing
-	flag.Var(&idx_in, "i", "")
-	flag.Var(&idx_out, "o", "")
+// checkLengths returns an error if the files are not all of the same
+// length.  Shards produced by rsc always are, so a shorter one was
+// most likely truncated, and decoding from it would silently treat the
+// missing tail as zeros.  Streams like stdin have no length to check
+// and are skipped.
+func checkLengths(files []*os.File) error {
+	var max int64
+	size := make([]int64, len(files))
+	regular := make([]bool, len(files))
+	for i, f := range files {
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if regular[i] = fi.Mode().IsRegular(); !regular[i] {
+			continue
+		}
+		size[i] = fi.Size()
+		if max < size[i] {
+			max = size[i]
+		}
+	}
+	for i, f := range files {
+		if regular[i] && size[i] < max {
+			return fmt.Errorf("%s is shorter than the other inputs (%d < %d bytes), it may be truncated", f.Name(), size[i], max)
+		}
+	}
+	return nil
+}
+
+// checkStdio returns an error if more than one of the names is "-",
+// which stands for stdin or stdout.
+func checkStdio(what string, names ...string) error {
+	n := 0
+	for _, name := range names {
+		if name == "-" {
+			n++
+		}
+	}
+	if n > 1 {
+		return fmt.Errorf("Only one %s can be -, not %d", what, n)
+	}
+	return nil
+}
+
+func openInput(name string) (*os.File, error) {
+	if name == "-" {
+		return os.Stdin, nil
+	}
+	return os.Open(name)
+}
+
+func openOutput(name string) (*os.File, error) {
+	if name == "-" {
+		return os.Stdout, nil
+	}
+	const O_OUTPUT = os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	return os.OpenFile(name, O_OUTPUT, 0644)
+}
+
+// writeTOC writes a table of contents recording the lengths of the
+// inputs to the named file.
+func writeTOC(name string, in_x, out_x []byte, block_size int, lengths []int64) error {
+	toc := &rs.TOC{InX: in_x, OutX: out_x, BlockSize: block_size, Lengths: lengths}
+	f, err := openOutput(name)
+	if err != nil {
+		return err
+	}
+	if _, err := toc.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readTOC(name string) (*rs.TOC, error) {
+	f, err := openInput(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	toc, err := rs.ReadTOC(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return toc, nil
+}
+
+// A truncWriter writes the first n bytes written to it to w, and
+// drops the rest.
+type truncWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (t *truncWriter) Write(b []byte) (int, error) {
+	l := len(b)
+	if int64(l) > t.n {
+		b = b[:t.n]
+	}
+	n, err := t.w.Write(b)
+	t.n -= int64(n)
+	if err != nil {
+		return n, err
+	}
+	return l, nil
+}
+
+// truncateOutputs wraps those writers that are originals according to
+// the toc so they cut off the zero padding.  Parity outputs are left
+// alone.  This works for streams, where the padding can't be removed
+// after writing.
+func truncateOutputs(toc *rs.TOC, out_x []byte, writers []io.Writer) {
+	for i := range writers {
+		if n, ok := toc.Length(out_x[i]); ok {
+			writers[i] = &truncWriter{writers[i], n}
+		}
+	}
+}
+
+// checkTruncated returns an error if one of the writers wrapped by
+// truncateOutputs got fewer bytes than the original length recorded
+// in the toc, which happens when decoding from shards that are
+// themselves truncated, e.g. without -strict.
+func checkTruncated(writers []io.Writer, names []string) error {
+	for i, w := range writers {
+		if t, ok := w.(*truncWriter); ok && t.n > 0 {
+			return fmt.Errorf("%s is %d bytes shorter than the original, the inputs may be truncated", names[i], t.n)
+		}
+	}
+	return nil
+}
+
+func main() {
+
+	strict := flag.Bool("strict", false, "refuse input files of unequal length, e.g. a truncated shard")
+	wtoc := flag.String("wtoc", "", "write a table of contents with the abscissae and input lengths to this file")
+	rtoc := flag.String("rtoc", "", "read a table of contents from this file and truncate the outputs to the original lengths")
+	block_size := sizeFlag{128 << 10}
+	flag.Var(&block_size, "b", "block size in bytes, with an optional k, M or G suffix")
+	jobs := flag.Int("j", 1, "code this many blocks in parallel, overlapping reading, coding and writing")
+	show_progress := flag.Bool("progress", false, "report the bytes read, percent complete and throughput to stderr every second")
+	verify := flag.Bool("verify", false, "read the output files and check that they match the inputs, rather than writing them")
+	show_plan := flag.Bool("plan", false, "print the blocks, output sizes, padding and memory the job would take, and exit")
 	flag.Usage = func() { usage("Error parsing flags.") }
-	flag.Parse()
 
-	if len(idx_in.values) == 0 || len(idx_out.values) == 0 {
-		usage("Please specify both input and output abscissae -i <byte>,... and -o <byte>,...")
+	cmd, err := parseArgs(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		usage(err)
+	}
+	idx_in, idx_out := cmd.idx_in, cmd.idx_out
+
+	if *verify {
+		if err := checkStdio("input", append(append(append([]string(nil), cmd.in_names...), cmd.out_names...), *rtoc)...); err != nil {
+			usage(err)
+		}
+	} else {
+		if err := checkStdio("input", append(append([]string(nil), cmd.in_names...), *rtoc)...); err != nil {
+			usage(err)
+		}
+		if err := checkStdio("output", append(append([]string(nil), cmd.out_names...), *wtoc)...); err != nil {
+			usage(err)
+		}
 	}
 
-	if len(flag.Args()) != len(idx_in.values)+len(idx_out.values) {
-		usage("Please specify as many input and output files as values to -i and -o.")
+	var toc *rs.TOC
+	if *rtoc != "" {
+		var err error
+		if toc, err = readTOC(*rtoc); err != nil {
+			crash(err)
+		}
+		if toc.Degree() != len(idx_in.values) {
+			crash(fmt.Sprintf("%s is for %d inputs, not %d", *rtoc, toc.Degree(), len(idx_in.values)))
+		}
+	}
+
+	if *show_plan {
+		sizes, err := fileSizes(cmd.in_names)
+		if err != nil {
+			crash(err)
+		}
+		truncated := map[int]int64{}
+		if toc != nil {
+			for k, x := range idx_out.values {
+				if n, ok := toc.Length(x); ok {
+					truncated[k] = n
+				}
+			}
+		}
+		p := makePlan(sizes, len(cmd.out_names), block_size.value, *jobs)
+		p.print(os.Stdout, &block_size, *jobs, cmd.in_names, cmd.out_names, truncated)
+		return
 	}
 
 	in_files := make([]*os.File, len(idx_in.values))
 
 	for i, _ := range in_files {
-		f, err := os.Open(flag.Arg(i))
+		f, err := openInput(cmd.in_names[i])
 		if err != nil {
-			crash("could not open ", flag.Arg(i), " for reading:", err)
+			crash("could not open ", cmd.in_names[i], " for reading:", err)
 		}
 		in_files[i] = f
 	}
 
+	if *strict {
+		if err := checkLengths(in_files); err != nil {
+			crash(err)
+		}
+	}
+
 	out_files := make([]*os.File, len(idx_out.values))
 
 	for i, _ := range out_files {
-		const O_OUTPUT = os.O_CREATE | os.O_TRUNC | os.O_WRONLY
-		f, err := os.OpenFile(flag.Arg(i+len(in_files)), O_OUTPUT, 0644)
+		if *verify {
+			f, err := openInput(cmd.out_names[i])
+			if err != nil {
+				crash("could not open ", cmd.out_names[i], " for reading:", err)
+			}
+			out_files[i] = f
+			continue
+		}
+		f, err := openOutput(cmd.out_names[i])
 		if err != nil {
-			crash("could not open ", flag.Arg(i+len(in_files)), " for writing:", err)
+			crash("could not open ", cmd.out_names[i], " for writing:", err)
 		}
 		out_files[i] = f
 	}
 
-	coder := rs.NewErasureCoder(idx_in.values, idx_out.values)
+	if block_size.value > kMaxSaneBlocksize {
+		fmt.Fprintf(os.Stderr, "Warning: block size %s needs that much memory per file and block in flight\n", &block_size)
+	}
 
-	const kBlocksize = 1024 << 7 // 128k
+	coder := rs.NewErasureCoder(idx_in.values, idx_out.values)
 
-	for {
-		in := make([][]byte, len(idx_in.values))
-		max_n := 0
-		all_closed := true
-		for i, f := range in_files {
-			in[i] = make([]byte, kBlocksize)
-			if f == nil {
-				continue
-			}
-			n, err := f.Read(in[i])
-			if err == nil {
-				all_closed = false
-			} else if err == io.EOF {
-				f.Close()
-				in_files[i] = nil
-			} else {
-				crash("Error reading from ", flag.Arg(i), ": ", err)
-			}
-			if max_n < n {
-				max_n = n
-			}
+	readers := make([]io.Reader, len(in_files))
+	for i, f := range in_files {
+		readers[i] = f
+	}
+	writers := make([]io.Writer, len(out_files))
+	verifiers := make([]*verifyWriter, len(out_files))
+	for i, f := range out_files {
+		writers[i] = f
+		if *verify {
+			verifiers[i] = &verifyWriter{name: cmd.out_names[i], r: f}
+			writers[i] = verifiers[i]
 		}
+	}
+	if toc != nil {
+		truncateOutputs(toc, idx_out.values, writers)
+	}
 
-		if max_n == 0 {
-			break
-		} else if max_n < kBlocksize {
-			for i := range in {
-				in[i] = in[i][0:max_n]
-			}
-		}
+	var prog *progress
+	if *show_progress {
+		prog = &progress{w: os.Stderr, tty: isTerminal(os.Stderr), total: totalSize(in_files)}
+		prog.wrap(readers)
+		prog.Start(time.Second)
+	}
 
-		out := coder.Code(in)
+	var read []int64
+	if *jobs > 1 {
+		if read, err = pipeline(coder, readers, writers, block_size.value, *jobs); err != nil {
+			crash("Error coding: ", err)
+		}
+	} else {
+		s, err := rs.NewStreamCoder(coder, readers, writers, block_size.value)
+		if err != nil {
+			crash(err)
+		}
+		if err := s.Run(); err != nil {
+			crash("Error coding: ", err)
+		}
+		read = s.BytesRead()
+	}
+	if prog != nil {
+		prog.Stop()
+	}
+	if err := checkTruncated(writers, cmd.out_names); err != nil {
+		crash(err)
+	}
 
-		for i, f := range out_files {
-			if _, err := f.Write(out[i]); err != nil {
-				crash("Error writing to ", flag.Arg(i+len(in_files)), ": ", err)
+	if *verify {
+		for _, v := range verifiers {
+			if err := v.Close(); err != nil {
+				crash(err)
 			}
 		}
+	}
+
+	for _, f := range in_files {
+		f.Close()
+	}
 
-		if all_closed {
-			break
+	if *wtoc != "" {
+		if err := writeTOC(*wtoc, idx_in.values, idx_out.values, block_size.value, read); err != nil {
+			crash(err)
 		}
 	}
 
 	for i, f := range out_files {
 		if err := f.Close(); err != nil {
-			crash("Error closing ", flag.Arg(i+len(in_files)), ": ", err)
+			crash("Error closing ", cmd.out_names[i], ": ", err)
 		}
 	}
 }
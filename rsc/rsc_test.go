@@ -0,0 +1,162 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func openFiles(t *testing.T, dir string, sizes ...int) []*os.File {
+	var files []*os.File
+	for i, n := range sizes {
+		name := filepath.Join(dir, "shard"+string('0'+rune(i)))
+		if err := os.WriteFile(name, make([]byte, n), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		files = append(files, f)
+	}
+	return files
+}
+
+func TestCheckLengths(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := checkLengths(openFiles(t, dir, 100, 100, 100)); err != nil {
+		t.Error(err)
+	}
+
+	// The middle shard was truncated.
+	if err := checkLengths(openFiles(t, dir, 100, 37, 100)); err == nil {
+		t.Error("checkLengths accepted a truncated shard")
+	}
+}
+
+func TestTOCTruncate(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "toc")
+	if err := writeTOC(name, []byte{0, 1, 2}, []byte{3}, 1024, []int64{100, 37, 100}); err != nil {
+		t.Fatal(err)
+	}
+	toc, err := readTOC(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Recovering original 1 and parity 3 from padded shards, in two writes.
+	var b1, b3 bytes.Buffer
+	w := []io.Writer{&b1, &b3}
+	truncateOutputs(toc, []byte{1, 3}, w)
+	for _, n := range []int{30, 70} {
+		for _, w := range w {
+			if m, err := w.Write(make([]byte, n)); m != n || err != nil {
+				t.Fatal("Write: ", m, err)
+			}
+		}
+	}
+	if b1.Len() != 37 || b3.Len() != 100 {
+		t.Errorf("outputs are %d and %d bytes, want 37 and 100", b1.Len(), b3.Len())
+	}
+}
+
+func TestCheckStdio(t *testing.T) {
+	if err := checkStdio("input", "a", "-", ""); err != nil {
+		t.Error(err)
+	}
+	if err := checkStdio("input", "-", "b", "-"); err == nil {
+		t.Error("checkStdio accepted two -")
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	for _, c := range []struct {
+		args    []string
+		in, out []string
+		strict  bool
+	}{
+		{
+			args: []string{"-i", "0,1,2", "foo0", "foo1", "foo2", "-o", "3,4", "foo.rs3", "foo.rs4"},
+			in:   []string{"foo0", "foo1", "foo2"}, out: []string{"foo.rs3", "foo.rs4"},
+		},
+		{
+			args: []string{"-o=3", "foo.rs3", "-strict", "-i", "0,1", "foo0", "foo1"},
+			in:   []string{"foo0", "foo1"}, out: []string{"foo.rs3"}, strict: true,
+		},
+		{
+			// The older form, all flags first.
+			args: []string{"-i", "0,1", "-o", "3", "-strict", "foo0", "foo1", "foo.rs3"},
+			in:   []string{"foo0", "foo1"}, out: []string{"foo.rs3"}, strict: true,
+		},
+		{
+			args: []string{"-i", "0", "-toc", "x.toc", "foo0", "-o", "1", "foo1"},
+			in:   []string{"foo0"}, out: []string{"foo1"},
+		},
+	} {
+		fs := flag.NewFlagSet("rsc", flag.ContinueOnError)
+		strict := fs.Bool("strict", false, "")
+		fs.String("toc", "", "")
+		cmd, err := parseArgs(fs, c.args)
+		if err != nil {
+			t.Errorf("%v: %v", c.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(cmd.in_names, c.in) || !reflect.DeepEqual(cmd.out_names, c.out) || *strict != c.strict {
+			t.Errorf("%v: got %v %v %v", c.args, cmd.in_names, cmd.out_names, *strict)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"foo0", "-i", "0", "-o", "1", "foo1"},
+		{"-i", "0,1", "foo0", "-o", "2", "foo2"},
+		{"-i", "0", "foo0", "foo1"},
+		{"-i", "0", "foo0", "-o"},
+		{"-i", "0", "foo0", "-o", "1", "foo1", "-bogus"},
+	} {
+		fs := flag.NewFlagSet("rsc", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		if _, err := parseArgs(fs, args); err == nil {
+			t.Errorf("%v: parsed without error", args)
+		}
+	}
+}
+
+func TestSizeFlag(t *testing.T) {
+	for s, want := range map[string]int{"1": 1, "4096": 4096, "64k": 64 << 10, "1M": 1 << 20, "1g": 1 << 30} {
+		var f sizeFlag
+		if err := f.Set(s); err != nil {
+			t.Errorf("Set(%q): %v", s, err)
+		} else if f.value != want {
+			t.Errorf("Set(%q) = %d, want %d", s, f.value, want)
+		}
+	}
+	for _, s := range []string{"", "0", "-1k", "k", "1.5M", "2G"} {
+		var f sizeFlag
+		if err := f.Set(s); err == nil {
+			t.Errorf("Set(%q) accepted", s)
+		}
+	}
+	if s := (&sizeFlag{128 << 10}).String(); s != "128k" {
+		t.Error("String: ", s)
+	}
+}
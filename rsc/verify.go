@@ -0,0 +1,63 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// A verifyWriter compares the bytes written to it with those read
+// from an existing shard, for -verify.  Write fails at the first
+// difference, naming the shard and the offset.
+type verifyWriter struct {
+	name string
+	r    io.Reader
+	off  int64
+	buf  []byte
+}
+
+func (v *verifyWriter) Write(b []byte) (int, error) {
+	if cap(v.buf) < len(b) {
+		v.buf = make([]byte, len(b))
+	}
+	buf := v.buf[:len(b)]
+	n, err := io.ReadFull(v.r, buf)
+	for j := 0; j < n; j++ {
+		if buf[j] != b[j] {
+			return j, fmt.Errorf("%s differs from the other shards at byte %d", v.name, v.off+int64(j))
+		}
+	}
+	v.off += int64(n)
+	switch err {
+	case nil:
+		return n, nil
+	case io.EOF, io.ErrUnexpectedEOF:
+		return n, fmt.Errorf("%s is shorter than the other shards (%d bytes)", v.name, v.off)
+	}
+	return n, fmt.Errorf("%s: %v", v.name, err)
+}
+
+// Close returns an error if the shard has bytes beyond those written.
+func (v *verifyWriter) Close() error {
+	n, err := io.Copy(io.Discard, v.r)
+	if err != nil {
+		return fmt.Errorf("%s: %v", v.name, err)
+	}
+	if n > 0 {
+		return fmt.Errorf("%s is %d bytes longer than the other shards", v.name, n)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"github.com/lvdlvd/go-encoding-rs"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestVerifyWriter(t *testing.T) {
+	coder := rs.NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	data := [][]byte{randomBytes(1000, 1), randomBytes(1000, 2), randomBytes(1000, 3)}
+	var want [2]bytes.Buffer
+	s, _ := rs.NewStreamCoder(coder, []io.Reader{bytes.NewReader(data[0]), bytes.NewReader(data[1]), bytes.NewReader(data[2])},
+		[]io.Writer{&want[0], &want[1]}, 256)
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	rot := append([]byte{}, want[1].Bytes()...)
+	rot[700] ^= 0x10
+	for _, c := range []struct {
+		shard []byte
+		err   string
+	}{
+		{want[1].Bytes(), ""},
+		{rot, "differs from the other shards at byte 700"},
+		{want[1].Bytes()[:999], "shorter"},
+		{append(want[1].Bytes(), 0), "1 bytes longer"},
+	} {
+		v := &verifyWriter{name: "foo.rs4", r: bytes.NewReader(c.shard)}
+		s, _ := rs.NewStreamCoder(coder, []io.Reader{bytes.NewReader(data[0]), bytes.NewReader(data[1]), bytes.NewReader(data[2])},
+			[]io.Writer{io.Discard, v}, 256)
+		err := s.Run()
+		if err == nil {
+			err = v.Close()
+		}
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%d bytes: %v", len(c.shard), err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("%d bytes: got %v, want %q", len(c.shard), err, c.err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// ShardName returns the conventional file name for the shard at abscissa x.
+func ShardName(x uint8) string {
+	return fmt.Sprintf("shard.%03d", x)
+}
+
+// ParseShardName is the inverse of ShardName.
+func ParseShardName(name string) (x uint8, err error) {
+	var v int
+	if n, err := fmt.Sscanf(name, "shard.%03d", &v); n != 1 || err != nil || v > 255 || ShardName(uint8(v)) != name {
+		return 0, fmt.Errorf("Not a shard name: %q", name)
+	}
+	return uint8(v), nil
+}
+
+// A WritableFS is an fs.FS that can also create files.
+type WritableFS interface {
+	fs.FS
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// WriteShardsFS writes shards[i] to dir/ShardName(in_x[i]) in fsys.
+func WriteShardsFS(fsys WritableFS, dir string, in_x []uint8, shards [][]uint8) error {
+	if len(in_x) != len(shards) {
+		return fmt.Errorf("Wrong number of shards: %d for %d abscissae", len(shards), len(in_x))
+	}
+	for i, x := range in_x {
+		if err := fsys.WriteFile(path.Join(dir, ShardName(x)), shards[i], 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadShardsFS reads all files in dir whose names were produced by
+// ShardName, in order of increasing abscissa.  Other files are ignored.
+func ReadShardsFS(fsys fs.FS, dir string) (in_x []uint8, shards [][]uint8, err error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		x, err := ParseShardName(e.Name())
+		if err != nil {
+			continue
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, nil, err
+		}
+		in_x = append(in_x, x)
+		shards = append(shards, b)
+	}
+	return in_x, shards, nil
+}
+
+// CASName returns the content addressed name for the shard at abscissa
+// x: its ShardName followed by the hex SHA-256 of its contents.
+func CASName(x uint8, shard []uint8) string {
+	sum := sha256.Sum256(shard)
+	return ShardName(x) + "." + hex.EncodeToString(sum[:])
+}
+
+// ScatterCAS codes in[] with coder and writes output k to fsys under
+// CASName(out_x[k], ...), returning the names in order, e.g. for a
+// manifest.  out_x must list the abscissae coder evaluates at; for a
+// coder that knows them, it is an error if they differ.
+func ScatterCAS(coder *ErasureCoder, in [][]uint8, out_x []uint8, fsys WritableFS) (names []string, err error) {
+	if len(out_x) != coder.NumOutputs() {
+		return nil, fmt.Errorf("Wrong number of abscissae: %d for Erasure coder with %d outputs", len(out_x), coder.NumOutputs())
+	}
+	if x := coder.OutputAbscissae(); x != nil {
+		for k := range x {
+			if x[k] != out_x[k] {
+				return nil, fmt.Errorf("Abscissa %d of out_x is %d, the coder's is %d", k, out_x[k], x[k])
+			}
+		}
+	}
+	out, err := coder.CodeErr(in)
+	if err != nil {
+		return nil, err
+	}
+	for k, x := range out_x {
+		name := CASName(x, out[k])
+		if err := fsys.WriteFile(name, out[k], 0644); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// GatherCAS reads the shards written by ScatterCAS under names[] and
+// returns those that exist and match their hash, with their abscissae,
+// ready to be passed to NewErasureCoder and Code for reconstruction.
+// Missing or corrupted shards are left out, as they are erasures.
+func GatherCAS(fsys fs.FS, names []string) (in_x []uint8, shards [][]uint8, err error) {
+	for _, name := range names {
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return nil, nil, fmt.Errorf("Not a content addressed shard name: %q", name)
+		}
+		x, err := ParseShardName(name[:i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("Not a content addressed shard name: %q", name)
+		}
+		b, err := fs.ReadFile(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if CASName(x, b) != name {
+			continue
+		}
+		in_x = append(in_x, x)
+		shards = append(shards, b)
+	}
+	return in_x, shards, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// mapFS makes an fstest.MapFS writable.
+type mapFS struct {
+	fstest.MapFS
+}
+
+func (m mapFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.MapFS[name] = &fstest.MapFile{Data: append([]byte(nil), data...), Mode: perm}
+	return nil
+}
+
+func TestShardName(t *testing.T) {
+	for _, x := range []uint8{0, 7, 42, 255} {
+		y, err := ParseShardName(ShardName(x))
+		if err != nil || x != y {
+			t.Errorf("ParseShardName(ShardName(%d)) = %d, %v", x, y, err)
+		}
+	}
+	for _, name := range []string{"", "shard.", "shard.7", "shard.256", "shard.042.tmp", "foo.001"} {
+		if _, err := ParseShardName(name); err == nil {
+			t.Errorf("ParseShardName(%q) succeeded", name)
+		}
+	}
+}
+
+func TestShardsFS(t *testing.T) {
+	in := [][]byte{
+		[]byte{1, 2, 3, 4, 5},
+		[]byte{41, 42, 43, 44, 45},
+		[]byte{11, 22, 33, 44, 55},
+	}
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	parity := c.Code(in)
+
+	fsys := mapFS{fstest.MapFS{"obj/README": &fstest.MapFile{Data: []byte("not a shard")}}}
+	if err := WriteShardsFS(fsys, "obj", []byte{0, 1, 2, 3, 4}, append(in, parity...)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lose two shards and rebuild from what is left.
+	delete(fsys.MapFS, "obj/"+ShardName(0))
+	delete(fsys.MapFS, "obj/"+ShardName(3))
+
+	in_x, shards, err := ReadShardsFS(fsys, "obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(in_x, []byte{1, 2, 4}) {
+		t.Fatal("read abscissae ", in_x)
+	}
+
+	out := NewErasureCoder(in_x, []byte{0}).Code(shards)
+	if !bytes.Equal(out[0], in[0]) {
+		t.Error(out[0], " != ", in[0])
+	}
+}
+
+func TestScatterCAS(t *testing.T) {
+	in := [][]byte{
+		[]byte{1, 2, 3, 4, 5},
+		[]byte{41, 42, 43, 44, 45},
+		[]byte{11, 22, 33, 44, 55},
+	}
+	out_x := []byte{0, 1, 2, 3, 4}
+	c := NewErasureCoder([]byte{0, 1, 2}, out_x)
+
+	fsys := mapFS{fstest.MapFS{}}
+	names, err := ScatterCAS(c, in, out_x, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := ScatterCAS(c, in, out_x, mapFS{fstest.MapFS{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range names {
+		if names[i] != again[i] {
+			t.Errorf("name %d not deterministic: %s != %s", i, names[i], again[i])
+		}
+	}
+
+	// Lose shard 1, corrupt shard 2: both are erasures.
+	delete(fsys.MapFS, names[1])
+	fsys.MapFS[names[2]].Data[0] ^= 1
+
+	in_x, shards, err := GatherCAS(fsys, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(in_x, []byte{0, 3, 4}) {
+		t.Fatal("gathered abscissae ", in_x)
+	}
+
+	out := NewErasureCoder(in_x, []byte{1, 2}).Code(shards)
+	for k, i := range []int{1, 2} {
+		if !bytes.Equal(out[k], in[i]) {
+			t.Error(out[k], " != ", in[i])
+		}
+	}
+}
+
+func TestScatterCASErrors(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	in := randomMatrix(3, 5, 2)
+	if _, err := ScatterCAS(c, in, []byte{3, 5}, mapFS{fstest.MapFS{}}); err == nil {
+		t.Error("ScatterCAS accepted abscissae the coder doesn't evaluate at")
+	}
+
+	// A ragged input is an error, not a panic, in strict mode too.
+	in[1] = in[1][:4]
+	defer SetStrictErrors(false)
+	for _, strict := range []bool{false, true} {
+		SetStrictErrors(strict)
+		if _, err := ScatterCAS(c, in, []byte{3, 4}, mapFS{fstest.MapFS{}}); err == nil {
+			t.Error("strict ", strict, ": ScatterCAS accepted a ragged input")
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import "fmt"
+
+// A Strategy is a way for an ErasureCoder to multiply its inputs by the
+// interpolation factors.  The first two look up products in 256 byte
+// tables, one per factor; they differ in where the tables live.  The
+// third doesn't use tables.
+type Strategy int
+
+const (
+	// At construction, build a private table for each distinct factor.
+	// Compact when there are few distinct factors, as in small or
+	// systematic codes.
+	CoefficientTables Strategy = iota
+
+	// Use the rows of a 64KB table of all products in the field, built
+	// once and shared by all coders over the field.  Saves each coder with many
+	// distinct factors from keeping tables of its own.
+	ProductTable
+
+	// Multiply bit by bit, like MulSlow, without any tables.  Many
+	// times slower, but free of table memory and of any doubt about
+	// table construction, e.g. to validate the tables on a new
+	// platform.  Never chosen automatically; see WithStrategy.
+	NoTables
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case CoefficientTables:
+		return "CoefficientTables"
+	case ProductTable:
+		return "ProductTable"
+	case NoTables:
+		return "NoTables"
+	}
+	return fmt.Sprintf("Strategy(%d)", int(s))
+}
+
+// Above this many distinct nonzero factors, i.e. 8KB of private tables,
+// an ErasureCoder uses the ProductTable.  BenchmarkStrategy shows the
+// two strategies are equally fast from small to large blocks, so the
+// choice is made on memory: a few private tables beat pulling in a
+// shared 64KB table, but many coders each holding a large part of it
+// don't.
+const productTableThreshold = 32
+
+// Pick the strategy for a matrix of interpolation factors.
+func chooseStrategy(interp [][]uint8) Strategy {
+	var seen [256]bool
+	n := 0
+	for _, row := range interp {
+		for _, c := range row {
+			if c != 0 && !seen[c] {
+				seen[c] = true
+				n++
+			}
+		}
+	}
+	if n > productTableThreshold {
+		return ProductTable
+	}
+	return CoefficientTables
+}
+
+// Set the strategy and build the tables it needs.
+func (p *ErasureCoder) setStrategy(s Strategy) {
+	p.strategy = s
+	p.tables = nil
+	if s != CoefficientTables {
+		return
+	}
+	var byCoef [256]*[256]uint8
+	p.tables = make([][]*[256]uint8, len(p.interp))
+	for i, row := range p.interp {
+		p.tables[i] = make([]*[256]uint8, len(row))
+		for k, c := range row {
+			if byCoef[c] == nil {
+				byCoef[c] = new([256]uint8)
+				p.field.mulTable(c, byCoef[c])
+			}
+			p.tables[i][k] = byCoef[c]
+		}
+	}
+}
+
+// Strategy returns the multiplication strategy the ErasureCoder chose
+// at construction, based on how many distinct factors it multiplies by.
+func (p *ErasureCoder) Strategy() Strategy {
+	return p.strategy
+}
+
+// WithStrategy returns a copy of the ErasureCoder that multiplies with
+// the given strategy rather than the one chosen at construction.  The
+// copy shares the immutable matrix of factors with the original.
+func (p *ErasureCoder) WithStrategy(s Strategy) *ErasureCoder {
+	if s < CoefficientTables || s > NoTables {
+		fail(fmt.Errorf("Unknown strategy %v", s))
+		return nil
+	}
+	q := &ErasureCoder{field: p.field, in_x: p.in_x, out_x: p.out_x, interp: p.interp}
+	q.setStrategy(s)
+	return q
+}
+
+// Xor src[] multiplied by interp[i][k] into dst[].
+func (p *ErasureCoder) mulAdd(dst, src []uint8, i, k int) {
+	switch c := p.interp[i][k]; {
+	case c == 0:
+	case c == 1:
+		addSlice(dst, src)
+	case p.strategy == NoTables:
+		cp := p.field.Polynomial()
+		dst = dst[:len(src)]
+		for j, v := range src {
+			dst[j] ^= poly_multiply(v, c, cp)
+		}
+	default:
+		mulAddTable(dst, src, p.table(i, k))
+	}
+}
+
+// Return the product table for interp[i][k].
+func (p *ErasureCoder) table(i, k int) *[256]uint8 {
+	if p.tables != nil {
+		return p.tables[i][k]
+	}
+	return &p.field.productTable()[p.interp[i][k]]
+}
@@ -0,0 +1,138 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// A k x m matrix with d distinct nonzero factors.
+func diverseMatrix(k, m, d int) [][]byte {
+	interp := makeMatrix(k, m)
+	for i := range interp {
+		for j := range interp[i] {
+			interp[i][j] = byte((i*m+j)%d + 1)
+		}
+	}
+	return interp
+}
+
+func TestStrategy(t *testing.T) {
+	if s := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4}).Strategy(); s != CoefficientTables {
+		t.Error("small coder uses ", s)
+	}
+	if s := chooseStrategy(diverseMatrix(16, 16, 200)); s != ProductTable {
+		t.Error("diverse coder uses ", s)
+	}
+
+	in := randomMatrix(16, 1000, 5)
+	var want [][]byte
+	for _, s := range []Strategy{CoefficientTables, ProductTable, NoTables} {
+		c := &ErasureCoder{field: defaultField, interp: diverseMatrix(16, 16, 200)}
+		c.setStrategy(s)
+		out := c.Code(in)
+		if want == nil {
+			want = out
+			continue
+		}
+		for k := range want {
+			if !bytes.Equal(out[k], want[k]) {
+				t.Errorf("%s: output %d differs", s, k)
+			}
+		}
+	}
+}
+
+func BenchmarkStrategy(b *testing.B) {
+	for _, n := range []int{64, 1 << 10, 64 << 10} {
+		for _, d := range []int{1, 8, 32, 64, 128, 255} {
+			in := randomMatrix(16, n, 1)
+			for _, s := range []Strategy{CoefficientTables, ProductTable} {
+				c := &ErasureCoder{field: defaultField, interp: diverseMatrix(16, 16, d)}
+				c.setStrategy(s)
+				b.Run(fmt.Sprintf("%s/n=%d/d=%d", s, n, d), func(b *testing.B) {
+					b.SetBytes(int64(16 * n))
+					for i := 0; i < b.N; i++ {
+						c.Code(in)
+					}
+				})
+			}
+		}
+	}
+}
+
+// Degree 10 on 128KB blocks, with the original per-byte mult for reference.
+func BenchmarkProductTable(b *testing.B) {
+	const n = 128 << 10
+	in_x := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	out_x := []byte{10, 11, 12, 13}
+	in := randomMatrix(len(in_x), n, 1)
+
+	b.Run("mult", func(b *testing.B) {
+		c := NewErasureCoder(in_x, out_x)
+		b.SetBytes(int64(len(in_x) * n))
+		for i := 0; i < b.N; i++ {
+			out := makeMatrix(len(out_x), n)
+			for i := range in {
+				for j := range in[i] {
+					for k := range out {
+						out[k][j] ^= mult(in[i][j], c.interp[i][k])
+					}
+				}
+			}
+		}
+	})
+	for _, s := range []Strategy{CoefficientTables, ProductTable} {
+		c := NewErasureCoder(in_x, out_x)
+		c.setStrategy(s)
+		b.Run(s.String(), func(b *testing.B) {
+			b.SetBytes(int64(len(in_x) * n))
+			for i := 0; i < b.N; i++ {
+				c.Code(in)
+			}
+		})
+	}
+}
+
+func TestWithStrategy(t *testing.T) {
+	f, _ := NewField(0x12D)
+	for _, c := range []*ErasureCoder{
+		NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4, 5}),
+		NewErasureCoderField(f, []byte{10, 20, 30}, []byte{40, 50}),
+	} {
+		in := randomMatrix(3, 100, 8)
+		want := c.Code(in)
+		slow := c.WithStrategy(NoTables)
+		if slow.Strategy() != NoTables || c.Strategy() == NoTables {
+			t.Fatal("WithStrategy: ", slow.Strategy(), c.Strategy())
+		}
+		out := slow.Code(in)
+		for k := range want {
+			if !bytes.Equal(out[k], want[k]) {
+				t.Errorf("%v: NoTables output %d differs", c, k)
+			}
+		}
+		delta := randomMatrix(1, 100, 9)[0]
+		c.Update(1, delta, want)
+		slow.Update(1, delta, out)
+		for k := range want {
+			if !bytes.Equal(out[k], want[k]) {
+				t.Errorf("%v: NoTables Update output %d differs", c, k)
+			}
+		}
+	}
+}
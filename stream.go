@@ -0,0 +1,496 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// A StreamCoder pumps blocks from a set of input streams through an
+// ErasureCoder to a set of output streams, like rsc does with files.
+// Each step reads a block of up to the block size from every input,
+// pads the short ones with zeros to the longest read, codes them and
+// writes the outputs.  Inputs may be of different lengths, including
+// empty; the outputs are as long as the longest input.  The buffers are
+// allocated once, by the first Step, so a StreamCoder doesn't
+// allocate per block.
+type StreamCoder struct {
+	coder      *ErasureCoder
+	in         []io.Reader
+	out        []io.Writer
+	block_size int
+
+	done      []bool    // input is at EOF
+	finished  bool      // all inputs are at EOF
+	inbuf     [][]uint8 // block_size per input, allocated by Step
+	outbuf    [][]uint8 // block_size per output, allocated by Step
+	written   int64     // per output
+	read      []int64   // per input
+	block_crc bool      // follow each output block by its CRC-32C
+	parallel  bool      // write the outputs of a block concurrently
+	errs      []error   // per output, for parallel writes
+}
+
+// NewStreamCoder returns a StreamCoder that codes in[] to out[] with
+// coder, block_size bytes at a time.  There must be as many inputs as
+// the coder's degree and as many outputs as it has.
+func NewStreamCoder(coder *ErasureCoder, in []io.Reader, out []io.Writer, block_size int) (*StreamCoder, error) {
+	if len(in) != coder.Degree() {
+		return nil, fmt.Errorf("Wrong number of inputs: %d for Erasure coder of degree: %d", len(in), coder.Degree())
+	}
+	if len(out) != coder.NumOutputs() {
+		return nil, fmt.Errorf("Wrong number of outputs: %d for Erasure coder with %d outputs", len(out), coder.NumOutputs())
+	}
+	if block_size <= 0 {
+		return nil, fmt.Errorf("Invalid block size %d", block_size)
+	}
+	return &StreamCoder{
+		coder:      coder,
+		in:         in,
+		out:        out,
+		block_size: block_size,
+		done:       make([]bool, len(in)),
+		read:       make([]int64, len(in)),
+	}, nil
+}
+
+// NewBlock returns buffers for one block of the inputs and one of the
+// outputs, for ReadBlock and ErasureCoder.CodeInto.
+func (s *StreamCoder) NewBlock() (in, out [][]uint8) {
+	return makeMatrix(len(s.in), s.block_size), makeMatrix(len(s.out), s.block_size)
+}
+
+// ReadBlock reads the next block of every input into in[], whose rows
+// must have a capacity of at least the block size, as those from
+// NewBlock, and reslices them to the length n of the block, the
+// longest read.  Shorter inputs are padded with zeros.  It returns
+// io.EOF, having read nothing, once all inputs are exhausted, or the
+// first read error.  ReadBlock is for callers that code and write the
+// blocks themselves, e.g. several at a time; Step reads with it.
+func (s *StreamCoder) ReadBlock(in [][]uint8) (n int, err error) {
+	if len(in) != len(s.in) {
+		return 0, fmt.Errorf("Wrong number of input buffers: %d for %d inputs", len(in), len(s.in))
+	}
+	for i := range in {
+		if cap(in[i]) < s.block_size {
+			return 0, fmt.Errorf("Input buffer %d too small: %d < block size %d", i, cap(in[i]), s.block_size)
+		}
+	}
+	if s.finished {
+		return 0, io.EOF
+	}
+
+	for i, r := range s.in {
+		buf := in[i][:s.block_size]
+		m := 0
+		if !s.done[i] {
+			var err error
+			m, err = io.ReadFull(r, buf)
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				s.done[i] = true
+			} else if err != nil {
+				return 0, err
+			}
+		}
+		s.read[i] += int64(m)
+		for j := m; j < len(buf); j++ {
+			buf[j] = 0
+		}
+		if n < m {
+			n = m
+		}
+	}
+
+	// ReadFull only comes up short at the end of an input.
+	if n < s.block_size {
+		s.finished = true
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	for i := range in {
+		in[i] = in[i][:n]
+	}
+	return n, nil
+}
+
+// Step codes the next block.  It returns io.EOF, having written
+// nothing, once all inputs are exhausted, or the first read or write
+// error.
+func (s *StreamCoder) Step() error {
+	if s.inbuf == nil {
+		s.inbuf, s.outbuf = s.NewBlock()
+	}
+	max_n, err := s.ReadBlock(s.inbuf)
+	if err != nil {
+		return err
+	}
+	for k := range s.outbuf {
+		s.outbuf[k] = s.outbuf[k][:max_n]
+	}
+	s.coder.CodeInto(s.inbuf, s.outbuf)
+
+	if s.parallel && len(s.out) > 1 {
+		if s.errs == nil {
+			s.errs = make([]error, len(s.out))
+		}
+		var wg sync.WaitGroup
+		for k := range s.out {
+			wg.Add(1)
+			go func(k int) {
+				defer wg.Done()
+				s.errs[k] = s.writeBlock(k)
+			}(k)
+		}
+		wg.Wait()
+		for _, err := range s.errs {
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		for k := range s.out {
+			if err := s.writeBlock(k); err != nil {
+				return err
+			}
+		}
+	}
+	s.written += int64(max_n)
+	return nil
+}
+
+// Write the current block of output k, and its CRC if enabled.
+func (s *StreamCoder) writeBlock(k int) error {
+	w := s.out[k]
+	if _, err := w.Write(s.outbuf[k]); err != nil {
+		return err
+	}
+	if s.block_crc {
+		var crc [blockCRCSize]uint8
+		binary.BigEndian.PutUint32(crc[:], crc32.Checksum(s.outbuf[k], castagnoli))
+		if _, err := w.Write(crc[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset points the StreamCoder at a new set of inputs and outputs, as
+// many as before, and clears what it has read and written, so that a
+// long lived service can code object after object with the same block
+// buffers rather than allocate them per object.  The block size and
+// SetBlockCRC are kept.  Reset must not be called during a Step, nor
+// during Run.
+func (s *StreamCoder) Reset(in []io.Reader, out []io.Writer) {
+	if len(in) != len(s.in) || len(out) != len(s.out) {
+		fail(fmt.Errorf("Wrong number of streams: %d inputs and %d outputs for %d and %d", len(in), len(out), len(s.in), len(s.out)))
+		return
+	}
+	s.in, s.out = in, out
+	for i := range s.done {
+		s.done[i] = false
+		s.read[i] = 0
+	}
+	s.finished = false
+	s.written = 0
+}
+
+// The size of the checksum following each block with SetBlockCRC.
+const blockCRCSize = 4
+
+// SetBlockCRC sets whether each block written to the outputs is
+// followed by its CRC-32C (Castagnoli) checksum, 4 bytes big-endian,
+// so that a reader can tell a corrupted block of a shard and treat it
+// as an erasure, as ReconstructStreamChecked does.  It must be called
+// before the first Step.
+func (s *StreamCoder) SetBlockCRC(on bool) {
+	s.block_crc = on
+}
+
+// SetParallelWrites sets whether the outputs of each block are written
+// concurrently, one goroutine per output, which overlaps the writes to
+// slow destinations such as network connections.  All writes of a
+// block finish before the next block is read, so each output still
+// gets its blocks in order.  Step then returns the error of the
+// lowest numbered output that failed, after all writes of the block
+// have returned.
+func (s *StreamCoder) SetParallelWrites(on bool) {
+	s.parallel = on
+}
+
+// Run calls Step until all inputs are exhausted.
+func (s *StreamCoder) Run() error {
+	for {
+		if err := s.Step(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// Written returns the number of bytes written to each output so far,
+// not counting the checksums of SetBlockCRC.
+func (s *StreamCoder) Written() int64 {
+	return s.written
+}
+
+// BytesRead returns the number of bytes read from each input so far,
+// which at the end are the lengths of the inputs.
+func (s *StreamCoder) BytesRead() []int64 {
+	return append([]int64(nil), s.read...)
+}
+
+// Close flushes the outputs that have a Flush() error method, like a
+// bufio.Writer, and then closes those that are io.Closers.  It returns
+// the first error encountered, but tries all outputs.
+func (s *StreamCoder) Close() error {
+	var first error
+	for _, w := range s.out {
+		if f, ok := w.(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil && first == nil {
+				first = err
+			}
+		}
+		if c, ok := w.(io.Closer); ok {
+			if err := c.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// ReconstructStreamMulti reads the survivors[] block by block and
+// writes to out[k] the data at abscissa want_x[k] reconstructed from
+// them, so all lost shards are recovered in a single pass over the
+// survivors.  survivors[i] must be the shard at abscissa survivor_x[i].
+// dec must have been constructed as NewErasureCoder(survivor_x, want_x);
+// if it is nil, ReconstructStreamMulti constructs it.  The decoder and
+// all buffers are shared across blocks, so the only allocation is the
+// initial one of block_size bytes per survivor and lost shard.
+//
+// Survivors that end early are padded with zeros, as rsc does, and the
+// outputs are as long as the longest survivor.
+func ReconstructStreamMulti(dec *ErasureCoder, survivors []io.Reader, survivor_x, want_x []uint8, out []io.Writer, block_size int) error {
+	if len(survivors) != len(survivor_x) {
+		return fmt.Errorf("Wrong number of survivors: %d for %d abscissae", len(survivors), len(survivor_x))
+	}
+	if len(out) != len(want_x) {
+		return fmt.Errorf("Wrong number of outputs: %d for %d abscissae", len(out), len(want_x))
+	}
+	if dec == nil {
+		dec = NewErasureCoder(survivor_x, want_x)
+	}
+	s, err := NewStreamCoder(dec, survivors, out, block_size)
+	if err != nil {
+		return err
+	}
+	return s.Run()
+}
+
+// A DecodeReader is an io.Reader of the shard at one abscissa,
+// reconstructed block by block from other shards as it is read, so a
+// lost shard can be streamed to its destination without ever being
+// held in memory in full.  Like rsc, it reads as far as the longest
+// shard, so a recovered original comes out zero padded; wrap it in an
+// io.LimitReader with the original length, e.g. from a TOC, to cut
+// the padding off.
+type DecodeReader struct {
+	s   *StreamCoder
+	buf []uint8 // the current block
+	pos int     // of the next unread byte in buf
+	err error   // sticky
+}
+
+// NewDecodeReader returns a DecodeReader of the shard at want_x,
+// reconstructed from the shards[i] at the distinct abscissae
+// shard_x[i], block_size bytes at a time.
+func NewDecodeReader(shards []io.Reader, shard_x []uint8, want_x uint8, block_size int) (*DecodeReader, error) {
+	if len(shards) != len(shard_x) {
+		return nil, fmt.Errorf("Wrong number of shards: %d for %d abscissae", len(shards), len(shard_x))
+	}
+	if err := coderAbscissaeError(shard_x, []uint8{want_x}); err != nil {
+		return nil, err
+	}
+	r := &DecodeReader{}
+	s, err := NewStreamCoder(NewErasureCoder(shard_x, []uint8{want_x}), shards, []io.Writer{(*decodeBlock)(r)}, block_size)
+	if err != nil {
+		return nil, err
+	}
+	r.s = s
+	r.buf = make([]uint8, 0, block_size)
+	return r, nil
+}
+
+// WriteTo writes the rest of the reconstructed shard to w, so that
+// io.Copy hands each block to w straight from the decoder, rather than
+// copying it through the buffers of Read and of io.Copy.
+func (r *DecodeReader) WriteTo(w io.Writer) (written int64, err error) {
+	if r.pos < len(r.buf) {
+		n, err := w.Write(r.buf[r.pos:])
+		r.pos += n
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	if r.err != nil {
+		if r.err == io.EOF {
+			return written, nil
+		}
+		return written, r.err
+	}
+
+	// Have the StreamCoder write to w directly until the end.
+	dst := &countWriter{w: w}
+	r.s.out[0] = dst
+	defer func() { r.s.out[0] = (*decodeBlock)(r) }()
+	if r.err = r.s.Run(); r.err == nil {
+		r.err = io.EOF
+		return written + dst.n, nil
+	}
+	return written + dst.n, r.err
+}
+
+// A countWriter counts the bytes written through it to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(b []uint8) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// A decodeBlock receives the blocks the StreamCoder of a DecodeReader
+// codes.
+type decodeBlock DecodeReader
+
+func (b *decodeBlock) Write(p []uint8) (int, error) {
+	b.buf = append(b.buf[:0], p...)
+	b.pos = 0
+	return len(p), nil
+}
+
+// Read reads the reconstructed shard.  It returns the first read error
+// of any of the shards, and io.EOF once they are all exhausted.
+func (r *DecodeReader) Read(p []uint8) (int, error) {
+	for r.pos == len(r.buf) {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.s.Step()
+	}
+	n := copy(p, r.buf[r.pos:])
+	r.pos += n
+	return n, nil
+}
+
+// ReconstructStreamChecked is like ReconstructStreamMulti, but for
+// shards written by a StreamCoder with SetBlockCRC, and it corrects for
+// corrupted blocks rather than only for missing shards: shards[i] is
+// the shard at abscissa shard_x[i] of a code of the given degree, and
+// each block of shards[] whose checksum doesn't match, or that is
+// shorter than the longest read, as from a truncated shard, is treated
+// as missing, the block of out[k] at want_x[k] being reconstructed from
+// the intact blocks of the others.  The outputs have no checksums.
+// It takes the same block_size as the StreamCoder, and fails if fewer
+// than degree shards have an intact block.  corrupt, if not nil, is
+// called with the index of the block and of the shard of each one
+// skipped.
+func ReconstructStreamChecked(degree int, shards []io.Reader, shard_x []uint8, want_x []uint8, out []io.Writer, block_size int, corrupt func(block, shard int)) error {
+	if len(shards) != len(shard_x) {
+		return fmt.Errorf("Wrong number of shards: %d for %d abscissae", len(shards), len(shard_x))
+	}
+	if len(out) != len(want_x) {
+		return fmt.Errorf("Wrong number of outputs: %d for %d abscissae", len(out), len(want_x))
+	}
+	if block_size <= 0 {
+		return fmt.Errorf("Invalid block size %d", block_size)
+	}
+	rec, err := NewReconstructCache(degree, shard_x, 16)
+	if err != nil {
+		return err
+	}
+
+	bufs := makeMatrix(len(shards), block_size+blockCRCSize)
+	done := make([]bool, len(shards))
+	lens := make([]int, len(shards)) // read in the current block
+	for block := 0; ; block++ {
+		// An intact block is as long as the longest read, a shorter
+		// one is from a truncated shard even if its checksum matches.
+		longest := 0
+		for i, r := range shards {
+			lens[i] = 0
+			if done[i] {
+				continue
+			}
+			n, err := io.ReadFull(r, bufs[i])
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				done[i] = true
+			} else if err != nil {
+				return err
+			}
+			lens[i] = n
+			if longest < n {
+				longest = n
+			}
+		}
+		if longest == 0 {
+			return nil
+		}
+
+		var present_x []uint8
+		var present [][]uint8
+		for i, n := range lens {
+			if n == 0 {
+				continue
+			}
+			if n != longest || !checkBlockCRC(bufs[i][:n]) {
+				if corrupt != nil {
+					corrupt(block, i)
+				}
+				continue
+			}
+			present_x = append(present_x, shard_x[i])
+			present = append(present, bufs[i][:n-blockCRCSize])
+		}
+		if len(present) < degree {
+			return fmt.Errorf("Block %d: only %d of %d shards intact", block, len(present), degree)
+		}
+		blocks, err := rec.Reconstruct(present_x, present, want_x)
+		if err != nil {
+			return err
+		}
+		for k, w := range out {
+			if _, err := w.Write(blocks[k]); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Report whether b is a block followed by its checksum.
+func checkBlockCRC(b []uint8) bool {
+	n := len(b) - blockCRCSize
+	return n >= 0 && crc32.Checksum(b[:n], castagnoli) == binary.BigEndian.Uint32(b[n:])
+}
@@ -0,0 +1,469 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestReconstructStreamMulti(t *testing.T) {
+	const n = 1000
+	data := randomMatrix(4, n, 7)
+	c := NewErasureCoder([]byte{0, 1, 2, 3}, []byte{4, 5})
+	parity := c.Code(data)
+
+	// Lose data shards 1 and 3, get them back from 0, 2, 4 and 5.
+	survivors := []io.Reader{
+		bytes.NewReader(data[0]),
+		bytes.NewReader(data[2]),
+		bytes.NewReader(parity[0]),
+		bytes.NewReader(parity[1]),
+	}
+	var got1, got3 bytes.Buffer
+	err := ReconstructStreamMulti(nil, survivors, []byte{0, 2, 4, 5}, []byte{1, 3}, []io.Writer{&got1, &got3}, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got1.Bytes(), data[1]) {
+		t.Error("shard 1 not recovered")
+	}
+	if !bytes.Equal(got3.Bytes(), data[3]) {
+		t.Error("shard 3 not recovered")
+	}
+}
+
+func TestReconstructStreamMultiShortSurvivor(t *testing.T) {
+	in := [][]byte{[]byte{1, 2, 3, 4, 5}, []byte{6, 7}}
+	c := NewErasureCoder([]byte{0, 1}, []byte{2})
+	padded := [][]byte{in[0], []byte{6, 7, 0, 0, 0}}
+	want := c.Code(padded)[0]
+
+	var got bytes.Buffer
+	survivors := []io.Reader{bytes.NewReader(in[0]), bytes.NewReader(in[1])}
+	if err := ReconstructStreamMulti(c, survivors, []byte{0, 1}, []byte{2}, []io.Writer{&got}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Error(got.Bytes(), " != ", want)
+	}
+}
+
+// A writer that remembers whether it was flushed and closed.
+type closeBuffer struct {
+	bytes.Buffer
+	flushed, closed bool
+}
+
+func (b *closeBuffer) Flush() error { b.flushed = true; return nil }
+func (b *closeBuffer) Close() error { b.closed = true; return nil }
+
+func TestStreamCoder(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4})
+	for _, lens := range [][3]int{{0, 0, 0}, {10, 10, 10}, {16, 16, 16}, {33, 0, 17}, {5, 40, 1}} {
+		for _, bs := range []int{1, 7, 16, 64} {
+			data := [][]byte{
+				randomMatrix(1, lens[0], 1)[0],
+				randomMatrix(1, lens[1], 2)[0],
+				randomMatrix(1, lens[2], 3)[0],
+			}
+			n := 0
+			for _, l := range lens {
+				if n < l {
+					n = l
+				}
+			}
+			padded := makeMatrix(3, n)
+			for i := range data {
+				copy(padded[i], data[i])
+			}
+			want := c.Code(padded)
+
+			out := []*closeBuffer{new(closeBuffer), new(closeBuffer)}
+			s, err := NewStreamCoder(c, []io.Reader{bytes.NewReader(data[0]), bytes.NewReader(data[1]), bytes.NewReader(data[2])}, []io.Writer{out[0], out[1]}, bs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Run(); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Step(); err != io.EOF {
+				t.Error("Step after Run: ", err)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if s.Written() != int64(n) {
+				t.Errorf("lengths %v, block size %d: wrote %d, want %d", lens, bs, s.Written(), n)
+			}
+			for i, r := range s.BytesRead() {
+				if r != int64(lens[i]) {
+					t.Errorf("lengths %v, block size %d: read %d from input %d", lens, bs, r, i)
+				}
+			}
+			for k := range want {
+				if !bytes.Equal(out[k].Bytes(), want[k]) {
+					t.Errorf("lengths %v, block size %d: output %d differs", lens, bs, k)
+				}
+				if !out[k].flushed || !out[k].closed {
+					t.Errorf("output %d not flushed and closed", k)
+				}
+			}
+		}
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("bad disk") }
+
+func TestStreamCoderReadError(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1}, []byte{2})
+	s, err := NewStreamCoder(c, []io.Reader{bytes.NewReader([]byte{1, 2, 3}), errReader{}}, []io.Writer{new(bytes.Buffer)}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Run(); err == nil || err.Error() != "bad disk" {
+		t.Error("Run returned ", err)
+	}
+}
+
+func TestStreamCoderReset(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1}, []byte{2, 3})
+	objects := [][][]byte{randomMatrix(2, 100, 1), {randomMatrix(1, 37, 2)[0], randomMatrix(1, 20, 3)[0]}}
+	var s *StreamCoder
+	for j, data := range objects {
+		in := []io.Reader{bytes.NewReader(data[0]), bytes.NewReader(data[1])}
+		parity := []*bytes.Buffer{new(bytes.Buffer), new(bytes.Buffer)}
+		out := []io.Writer{parity[0], parity[1]}
+		if s == nil {
+			var err error
+			if s, err = NewStreamCoder(c, in, out, 16); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			s.Reset(in, out)
+		}
+		if err := s.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(data[0]); s.Written() != int64(n) || s.BytesRead()[1] != int64(len(data[1])) {
+			t.Errorf("object %d: wrote %d, read %v", j, s.Written(), s.BytesRead())
+		}
+
+		// Decode the object from its parity alone.
+		dec := NewErasureCoder([]byte{2, 3}, []byte{0, 1}).Code([][]byte{parity[0].Bytes(), parity[1].Bytes()})
+		for i := range data {
+			if !bytes.Equal(dec[i][:len(data[i])], data[i]) {
+				t.Errorf("object %d: input %d not decoded", j, i)
+			}
+		}
+	}
+}
+
+func TestStreamCoderResetPanicOnWrongCount(t *testing.T) {
+	defer recoverExpected(t)
+	s, _ := NewStreamCoder(NewErasureCoder([]byte{0, 1}, []byte{2}), []io.Reader{nil, nil}, []io.Writer{nil}, 16)
+	s.Reset([]io.Reader{nil}, []io.Writer{nil}) // should panic
+	t.Error("Failed to panic")
+}
+
+// A slowWriter takes a while over each write, and keeps track of how
+// many slowWriters are writing at once.
+type slowWriter struct {
+	bytes.Buffer
+	busy, max *int32
+	err       error
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	n := atomic.AddInt32(w.busy, 1)
+	defer atomic.AddInt32(w.busy, -1)
+	for {
+		m := atomic.LoadInt32(w.max)
+		if n <= m || atomic.CompareAndSwapInt32(w.max, m, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestStreamCoderParallelWrites(t *testing.T) {
+	c := NewErasureCoder([]byte{0, 1}, []byte{2, 3, 4, 5})
+	data := randomMatrix(2, 100, 4)
+	want := c.Code(data)
+	var busy, max int32
+	out := make([]*slowWriter, 4)
+	writers := make([]io.Writer, 4)
+	for k := range out {
+		out[k] = &slowWriter{busy: &busy, max: &max}
+		writers[k] = out[k]
+	}
+	s, err := NewStreamCoder(c, []io.Reader{bytes.NewReader(data[0]), bytes.NewReader(data[1])}, writers, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetParallelWrites(true)
+	s.SetBlockCRC(true)
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&max) < 2 {
+		t.Error("outputs were written one at a time")
+	}
+	for k := range want {
+		var got []byte
+		for b := out[k].Bytes(); len(b) > 0; {
+			n := 16
+			if len(b) < n+blockCRCSize {
+				n = len(b) - blockCRCSize
+			}
+			if !checkBlockCRC(b[:n+blockCRCSize]) {
+				t.Errorf("output %d: bad block CRC", k)
+			}
+			got, b = append(got, b[:n]...), b[n+blockCRCSize:]
+		}
+		if !bytes.Equal(got, want[k]) {
+			t.Errorf("output %d differs", k)
+		}
+	}
+
+	// The error of the lowest failing output is returned.
+	for k := range out {
+		out[k].Reset()
+	}
+	out[1].err = errors.New("link 1 down")
+	out[3].err = errors.New("link 3 down")
+	s.Reset([]io.Reader{bytes.NewReader(data[0]), bytes.NewReader(data[1])}, writers)
+	if err := s.Step(); err == nil || err.Error() != "link 1 down" {
+		t.Error("Step returned ", err)
+	}
+	if atomic.LoadInt32(&busy) != 0 {
+		t.Error("Step returned with writes in flight: ", busy)
+	}
+}
+
+func TestStreamCoderReadBlock(t *testing.T) {
+	coder := NewErasureCoder([]byte{0, 1}, []byte{2})
+	data := randomMatrix(2, 25, 6)
+	s, err := NewStreamCoder(coder, []io.Reader{bytes.NewReader(data[0]), bytes.NewReader(data[1][:5])}, []io.Writer{io.Discard}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, out := s.NewBlock()
+	if len(in) != 2 || len(out) != 1 || len(in[0]) != 10 || len(out[0]) != 10 {
+		t.Fatal("NewBlock: ", len(in), len(out))
+	}
+	for _, want := range []int{10, 10, 5} {
+		n, err := s.ReadBlock(in)
+		if err != nil || n != want || len(in[0]) != n || len(in[1]) != n {
+			t.Fatal("ReadBlock: ", n, err, ", want ", want)
+		}
+	}
+	if !bytes.Equal(in[0], data[0][20:]) || !bytes.Equal(in[1], make([]byte, 5)) {
+		t.Error("last block not read and zero padded: ", in)
+	}
+	if n, err := s.ReadBlock(in); n != 0 || err != io.EOF {
+		t.Error("ReadBlock at the end: ", n, err)
+	}
+	if r := s.BytesRead(); r[0] != 25 || r[1] != 5 {
+		t.Error("BytesRead: ", r)
+	}
+	if _, err := s.ReadBlock(in[:1]); err == nil {
+		t.Error("ReadBlock accepted too few buffers")
+	}
+	if _, err := s.ReadBlock([][]byte{in[0], make([]byte, 9)}); err == nil {
+		t.Error("ReadBlock accepted a buffer shorter than the block size")
+	}
+}
+
+func TestDecodeReader(t *testing.T) {
+	enc := NewErasureCoder([]byte{0, 1, 2}, []byte{3, 4, 5})
+	data := randomMatrix(3, 1000, 5)
+	parity := enc.Code(data)
+
+	// Original 1 from 0, 3 and 5, with a short last block.
+	r, err := NewDecodeReader([]io.Reader{bytes.NewReader(data[0]), bytes.NewReader(parity[0]), bytes.NewReader(parity[2])},
+		[]byte{0, 3, 5}, 1, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(iotest.OneByteReader(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data[1]) {
+		t.Error("reconstructed data differs")
+	}
+
+	if _, err := NewDecodeReader([]io.Reader{bytes.NewReader(nil)}, []byte{0, 0}, 1, 300); err == nil {
+		t.Error("NewDecodeReader accepted a mismatched number of shards")
+	}
+	if _, err := NewDecodeReader([]io.Reader{bytes.NewReader(nil), bytes.NewReader(nil)}, []byte{0, 0}, 1, 300); err == nil {
+		t.Error("NewDecodeReader accepted duplicate abscissae")
+	}
+
+	r, _ = NewDecodeReader([]io.Reader{bytes.NewReader(data[0]), errReader{}}, []byte{0, 3}, 1, 300)
+	if _, err := io.ReadAll(r); err == nil || err.Error() != "bad disk" {
+		t.Error("ReadAll returned ", err)
+	}
+}
+
+func TestDecodeReaderWriteTo(t *testing.T) {
+	enc := NewErasureCoder([]byte{0, 1}, []byte{2, 3})
+	data := randomMatrix(2, 1000, 8)
+	parity := enc.Code(data)
+	newReader := func() *DecodeReader {
+		r, err := NewDecodeReader([]io.Reader{bytes.NewReader(parity[0]), bytes.NewReader(parity[1])}, []byte{2, 3}, 0, 300)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	// All of it through io.Copy, which uses WriteTo.
+	var buf bytes.Buffer
+	if n, err := io.Copy(&buf, newReader()); n != 1000 || err != nil {
+		t.Fatal("io.Copy: ", n, err)
+	}
+	if !bytes.Equal(buf.Bytes(), data[0]) {
+		t.Error("WriteTo: data differs")
+	}
+
+	// The same through io.Copy from a reader that hides WriteTo, which
+	// falls back to Read.
+	buf.Reset()
+	if n, err := io.Copy(&buf, struct{ io.Reader }{newReader()}); n != 1000 || err != nil {
+		t.Fatal("io.Copy without WriteTo: ", n, err)
+	}
+	if !bytes.Equal(buf.Bytes(), data[0]) {
+		t.Error("Read: data differs")
+	}
+
+	// Part of a block through Read, then the rest through WriteTo.
+	r := newReader()
+	head := make([]byte, 10)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if n, err := r.WriteTo(&buf); n != 990 || err != nil {
+		t.Fatal("WriteTo: ", n, err)
+	}
+	if !bytes.Equal(append(head, buf.Bytes()...), data[0]) {
+		t.Error("Read, then WriteTo: data differs")
+	}
+	if n, err := r.Read(head); n != 0 || err != io.EOF {
+		t.Error("Read after WriteTo: ", n, err)
+	}
+
+	r, _ = NewDecodeReader([]io.Reader{bytes.NewReader(parity[0]), errReader{}}, []byte{2, 3}, 0, 300)
+	if _, err := r.WriteTo(&buf); err == nil || err.Error() != "bad disk" {
+		t.Error("WriteTo returned ", err)
+	}
+}
+
+func TestReconstructStreamChecked(t *testing.T) {
+	const n, bs = 1000, 256 // 4 blocks, the last one short
+	data := randomMatrix(3, n, 6)
+	c := NewVandermondeCoder(3, 2)
+	var shards [5]bytes.Buffer
+	s, err := NewStreamCoder(c, []io.Reader{bytes.NewReader(data[0]), bytes.NewReader(data[1]), bytes.NewReader(data[2])},
+		[]io.Writer{&shards[0], &shards[1], &shards[2], &shards[3], &shards[4]}, bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetBlockCRC(true)
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if l := shards[0].Len(); l != n+4*blockCRCSize {
+		t.Fatal("shard of ", l, " bytes")
+	}
+
+	decode := func(flip ...[2]int) ([][]byte, [][2]int, error) {
+		readers := make([]io.Reader, 5)
+		for i := range shards {
+			b := append([]byte{}, shards[i].Bytes()...)
+			for _, f := range flip {
+				if f[1] == i {
+					b[f[0]*(bs+blockCRCSize)+7] ^= 1
+				}
+			}
+			readers[i] = bytes.NewReader(b)
+		}
+		var out [3]bytes.Buffer
+		var bad [][2]int
+		err := ReconstructStreamChecked(3, readers, []byte{0, 1, 2, 3, 4}, []byte{0, 1, 2}, []io.Writer{&out[0], &out[1], &out[2]}, bs,
+			func(block, shard int) { bad = append(bad, [2]int{block, shard}) })
+		return [][]byte{out[0].Bytes(), out[1].Bytes(), out[2].Bytes()}, bad, err
+	}
+
+	// Two bad blocks in block 1, one each in blocks 0 and 3.
+	flips := [][2]int{{1, 0}, {1, 4}, {0, 2}, {3, 1}}
+	out, bad, err := decode(flips...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range data {
+		if !bytes.Equal(out[i], data[i]) {
+			t.Errorf("data shard %d not recovered", i)
+		}
+	}
+	if len(bad) != len(flips) {
+		t.Error("corrupt blocks reported: ", bad)
+	}
+
+	// Shard 0 cut short after block 1, with a 1 byte block that has a
+	// valid checksum of its own: only shard 0 is corrupt in block 2.
+	truncated := append([]byte{}, shards[0].Bytes()[:2*(bs+blockCRCSize)]...)
+	truncated = append(truncated, 0xab)
+	truncated = binary.BigEndian.AppendUint32(truncated, crc32.Checksum([]byte{0xab}, castagnoli))
+	readers := []io.Reader{bytes.NewReader(truncated)}
+	for i := 1; i < 5; i++ {
+		readers = append(readers, bytes.NewReader(shards[i].Bytes()))
+	}
+	var rec [3]bytes.Buffer
+	bad = nil
+	err = ReconstructStreamChecked(3, readers, []byte{0, 1, 2, 3, 4}, []byte{0, 1, 2}, []io.Writer{&rec[0], &rec[1], &rec[2]}, bs,
+		func(block, shard int) { bad = append(bad, [2]int{block, shard}) })
+	if err != nil {
+		t.Fatal("truncated shard 0: ", err)
+	}
+	for i := range data {
+		if !bytes.Equal(rec[i].Bytes(), data[i]) {
+			t.Errorf("truncated shard 0: data shard %d not recovered", i)
+		}
+	}
+	if len(bad) != 1 || bad[0] != [2]int{2, 0} {
+		t.Error("truncated shard 0: corrupt blocks reported: ", bad)
+	}
+
+	// Three bad blocks in block 2 leave only two intact.
+	if _, _, err := decode([2]int{2, 0}, [2]int{2, 1}, [2]int{2, 3}); err == nil {
+		t.Error("no error for too many corrupt blocks")
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import "fmt"
+
+// Check the parameters of a systematic code with k data and m parity shards.
+func systematicError(k, m int) error {
+	if k < 1 || m < 0 || k+m > 256 {
+		return fmt.Errorf("Invalid code with %d data and %d parity shards", k, m)
+	}
+	return nil
+}
+
+// Return the abscissae 0, 1, ..., n-1.
+func iota8(n int) []uint8 {
+	x := make([]uint8, n)
+	for i := range x {
+		x[i] = uint8(i)
+	}
+	return x
+}
+
+// ChooseAbscissae returns distinct abscissae for k data and m parity
+// shards, in_x = 0...k-1 and out_x = k...k+m-1, such that
+// NewErasureCoder(in_x, out_x) computes the parity from the data.  Any
+// k+m distinct abscissae will do, there are just 256 of them, so it
+// panics if k+m > 256.
+func ChooseAbscissae(k, m int) (in_x, out_x []uint8) {
+	if err := systematicError(k, m); err != nil {
+		fail(err)
+		return nil, nil
+	}
+	x := iota8(k + m)
+	return x[:k:k], x[k:]
+}
+
+// NewVandermondeCoder returns a systematic coder for k data and m
+// parity shards: its k+m outputs are the k inputs, followed by m parity
+// shards.  Its generator matrix is that of the Vandermonde matrix on
+// the abscissae 0...k+m-1 times the inverse of its top k x k square,
+// i.e. the identity on top of the parity rows, which is exactly
+// NewErasureCoder(0...k-1, 0...k+m-1).  Computing the data outputs is a
+// plain copy.
+func NewVandermondeCoder(k, m int) *ErasureCoder {
+	if err := systematicError(k, m); err != nil {
+		fail(err)
+		return nil
+	}
+	return NewErasureCoder(iota8(k), iota8(k+m))
+}
+
+// NewCauchyCoder returns a systematic coder for k data and m parity
+// shards, like NewVandermondeCoder, but with the parity rows of its
+// generator matrix forming the Cauchy matrix 1 / (x_r + y_c) on x_r =
+// k+r and y_c = c.  Every square submatrix of a Cauchy matrix is
+// invertible, so any k of the k+m outputs determine the data.
+//
+// A Cauchy coder does not evaluate a polynomial, so its shards have no
+// abscissae and can't be decoded with NewErasureCoder; decode them with
+// NewCauchyDecoder instead.
+func NewCauchyCoder(k, m int) *ErasureCoder {
+	if err := systematicError(k, m); err != nil {
+		fail(err)
+		return nil
+	}
+	interp := makeMatrix(k, k+m)
+	for i := 0; i < k; i++ {
+		interp[i][i] = 1
+		for r := 0; r < m; r++ {
+			interp[i][k+r] = inv[uint8(k+r)^uint8(i)]
+		}
+	}
+	return newCoder(defaultField, interp)
+}
+
+// NewCauchyDecoder returns the coder that computes the k data shards
+// of NewCauchyCoder(k, m) from the k surviving shards at the indices
+// present[], in that order, among the coder's k+m outputs: its inputs
+// are those shards and its outputs the data shards 0...k-1.  It is
+// the inverse of the generator rows of the survivors, which always
+// exists for a Cauchy code.  It panics if present[] are not k distinct
+// indices below k+m.
+func NewCauchyDecoder(k, m int, present []int) *ErasureCoder {
+	if err := systematicError(k, m); err != nil {
+		fail(err)
+		return nil
+	}
+	if len(present) != k {
+		fail(fmt.Errorf("Wrong number of shards: %d present for %d data shards", len(present), k))
+		return nil
+	}
+	parity := CauchyGeneratorMatrix(k, m)
+	rows := makeMatrix(k, k)
+	var seen [256]bool
+	for j, s := range present {
+		if s < 0 || s >= k+m || seen[s] {
+			fail(fmt.Errorf("Invalid or repeated shard index %d in present", s))
+			return nil
+		}
+		seen[s] = true
+		if s < k {
+			rows[j][s] = 1
+		} else {
+			copy(rows[j], parity[s-k])
+		}
+	}
+	m_inv, err := invertMatrix(defaultField, rows)
+	if err != nil {
+		fail(err)
+		return nil
+	}
+	return newCoder(defaultField, transpose(m_inv))
+}
+
+// GeneratorMatrix returns the m x k parity part of the generator
+// matrix of NewVandermondeCoder(k, m): parity shard r is the sum over
+// i of GeneratorMatrix(k, m)[r][i] times data shard i.  The full
+// generator matrix is the k x k identity on top of it.  Compare it with
+// another library's to check that their shards are interchangeable.
+func GeneratorMatrix(k, m int) [][]uint8 {
+	if err := systematicError(k, m); err != nil {
+		fail(err)
+		return nil
+	}
+	return NewErasureCoder(iota8(k), iota8(k + m)[k:]).EncodingMatrix()
+}
+
+// CauchyGeneratorMatrix is GeneratorMatrix for NewCauchyCoder(k, m).
+func CauchyGeneratorMatrix(k, m int) [][]uint8 {
+	if err := systematicError(k, m); err != nil {
+		fail(err)
+		return nil
+	}
+	return NewCauchyCoder(k, m).EncodingMatrix()[k:]
+}
@@ -0,0 +1,165 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVandermondeCoder(t *testing.T) {
+	c := NewVandermondeCoder(4, 3)
+	if c.Degree() != 4 || c.NumOutputs() != 7 {
+		t.Fatal("Degree, NumOutputs: ", c.Degree(), c.NumOutputs())
+	}
+	data := randomMatrix(4, 100, 3)
+	out := c.Code(data)
+	for i := range data {
+		if !bytes.Equal(out[i], data[i]) {
+			t.Errorf("output %d is not a copy of input %d", i, i)
+		}
+	}
+
+	// Any 4 of the 7 recover the data.
+	dec := NewErasureCoder([]byte{1, 4, 5, 6}, []byte{0, 2, 3})
+	rec := dec.Code([][]byte{out[1], out[4], out[5], out[6]})
+	for j, i := range []int{0, 2, 3} {
+		if !bytes.Equal(rec[j], data[i]) {
+			t.Errorf("input %d not recovered", i)
+		}
+	}
+
+	// Update keeps the parity current.
+	delta := randomMatrix(1, 100, 4)[0]
+	c.Update(2, delta, out)
+	for j, v := range delta {
+		data[2][j] ^= v
+	}
+	want := c.Code(data)
+	for k := range want {
+		if !bytes.Equal(out[k], want[k]) {
+			t.Errorf("output %d wrong after Update", k)
+		}
+	}
+}
+
+func TestVandermondeCoderPanicOnTooManyShards(t *testing.T) {
+	defer recoverExpected(t)
+	NewVandermondeCoder(200, 57) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestChooseAbscissae(t *testing.T) {
+	in_x, out_x := ChooseAbscissae(3, 2)
+	if !bytes.Equal(in_x, []byte{0, 1, 2}) || !bytes.Equal(out_x, []byte{3, 4}) {
+		t.Error("ChooseAbscissae(3, 2) = ", in_x, out_x)
+	}
+	in_x, out_x = ChooseAbscissae(250, 6)
+	if err := abscissaeError("all", append(append([]byte{}, in_x...), out_x...)); err != nil {
+		t.Error(err)
+	}
+	// Appending to in_x must not clobber out_x.
+	in_x, out_x = ChooseAbscissae(2, 1)
+	_ = append(in_x, 99)
+	if out_x[0] != 2 {
+		t.Error("out_x aliased by in_x: ", out_x)
+	}
+}
+
+func TestChooseAbscissaePanicOnTooMany(t *testing.T) {
+	defer recoverExpected(t)
+	ChooseAbscissae(255, 2) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestCauchyCoder(t *testing.T) {
+	const k, m = 5, 4
+	c := NewCauchyCoder(k, m)
+	if c.Degree() != k || c.NumOutputs() != k+m {
+		t.Fatal("Degree, NumOutputs: ", c.Degree(), c.NumOutputs())
+	}
+	data := randomMatrix(k, 50, 7)
+	out := c.Code(data)
+	for i := range data {
+		if !bytes.Equal(out[i], data[i]) {
+			t.Errorf("output %d is not a copy of input %d", i, i)
+		}
+	}
+
+	// Every k of the k+m shards decode.
+	n := 0
+	forSubsets(k+m, k, func(s []int) bool {
+		n++
+		shards := make([][]byte, k)
+		for j, r := range s {
+			shards[j] = out[r]
+		}
+		rec := NewCauchyDecoder(k, m, s).Code(shards)
+		for i := range data {
+			if !bytes.Equal(rec[i], data[i]) {
+				t.Fatalf("shards %v: input %d not recovered", s, i)
+			}
+		}
+		return true
+	})
+	if n != 126 {
+		t.Error("tried ", n, " subsets, want 126")
+	}
+}
+
+func TestCauchyDecoderPanicOnRepeatedShard(t *testing.T) {
+	defer recoverExpected(t)
+	NewCauchyDecoder(3, 2, []int{0, 4, 4}) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestCauchyDecoderPanicOnBadIndex(t *testing.T) {
+	defer recoverExpected(t)
+	NewCauchyDecoder(3, 2, []int{0, 1, 5}) // should panic
+	t.Error("Failed to panic")
+}
+
+func TestGeneratorMatrix(t *testing.T) {
+	// Known values, to catch any change in the construction.
+	if g := GeneratorMatrix(2, 1); !bytes.Equal(g[0], []byte{3, 2}) || len(g) != 1 {
+		t.Error("GeneratorMatrix(2, 1) = ", g)
+	}
+	if g := CauchyGeneratorMatrix(2, 1); !bytes.Equal(g[0], []byte{Inv(2), Inv(3)}) || len(g) != 1 {
+		t.Error("CauchyGeneratorMatrix(2, 1) = ", g)
+	}
+
+	for _, c := range []struct {
+		coder *ErasureCoder
+		gen   [][]byte
+	}{
+		{NewVandermondeCoder(4, 3), GeneratorMatrix(4, 3)},
+		{NewCauchyCoder(4, 3), CauchyGeneratorMatrix(4, 3)},
+	} {
+		if len(c.gen) != 3 {
+			t.Fatal("parity rows: ", len(c.gen))
+		}
+		data := randomMatrix(4, 30, 2)
+		out := c.coder.Code(data)
+		for r, row := range c.gen {
+			p := make([]byte, 30)
+			for i, g := range row {
+				MulSliceXor(p, data[i], g)
+			}
+			if !bytes.Equal(p, out[4+r]) {
+				t.Errorf("%v: parity %d differs from the generator matrix", c.coder, r)
+			}
+		}
+	}
+}
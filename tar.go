@@ -0,0 +1,135 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// The name of the metadata entry written by ShardsToTar.  It holds
+// lines of the form "key value", currently
+//
+//	rs-tar 1       the format version
+//	length <n>     the original length of the data
+const tarMetaName = "rs.meta"
+
+const tarVersion = 1
+
+// SupportedFormats returns the archive format versions TarToShards can
+// read.  ShardsToTar always writes the last one.
+func SupportedFormats() []int {
+	return []int{1}
+}
+
+// ShardsToTar writes shards[i] to w as a tar entry named
+// ShardName(in_x[i]), followed by a metadata entry recording orig_len,
+// the length of the data before padding, so that a whole erasure
+// coded object can be stored as one portable archive.
+func ShardsToTar(w io.Writer, in_x []uint8, shards [][]uint8, orig_len int) error {
+	if len(in_x) != len(shards) {
+		return fmt.Errorf("Wrong number of shards: %d for %d abscissae", len(shards), len(in_x))
+	}
+	tw := tar.NewWriter(w)
+	for i, x := range in_x {
+		hdr := &tar.Header{Name: ShardName(x), Mode: 0644, Size: int64(len(shards[i])), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(shards[i]); err != nil {
+			return err
+		}
+	}
+	meta := []byte(fmt.Sprintf("rs-tar %d\nlength %d\n", tarVersion, orig_len))
+	hdr := &tar.Header{Name: tarMetaName, Mode: 0644, Size: int64(len(meta)), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(meta); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// TarToShards reads back an archive written by ShardsToTar, returning
+// the shards it still contains with their abscissae, in archive order.
+// Entries that went missing are simply absent from the result; as long
+// as enough remain, the lost ones can be reconstructed.  If the
+// metadata entry was lost too, orig_len is -1.  Unknown entries are
+// ignored.
+func TarToShards(r io.Reader) (in_x []uint8, shards [][]uint8, orig_len int, err error) {
+	orig_len = -1
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, -1, err
+		}
+		if hdr.Name == tarMetaName {
+			if orig_len, err = parseTarMeta(tr); err != nil {
+				return nil, nil, -1, err
+			}
+			continue
+		}
+		x, err := ParseShardName(hdr.Name)
+		if err != nil {
+			continue
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, -1, err
+		}
+		in_x = append(in_x, x)
+		shards = append(shards, b)
+	}
+	return in_x, shards, orig_len, nil
+}
+
+func parseTarMeta(r io.Reader) (orig_len int, err error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return -1, err
+	}
+	var version int
+	orig_len = -1
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		var key string
+		var val int
+		if _, err := fmt.Sscanf(s.Text(), "%s %d", &key, &val); err != nil {
+			return -1, fmt.Errorf("Bad metadata line %q", s.Text())
+		}
+		switch key {
+		case "rs-tar":
+			version = val
+		case "length":
+			orig_len = val
+		}
+	}
+	supported := false
+	for _, v := range SupportedFormats() {
+		supported = supported || v == version
+	}
+	if !supported {
+		return -1, fmt.Errorf("Unsupported archive version %d", version)
+	}
+	return orig_len, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"archive/tar"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "regenerate the testdata archive for the current format")
+
+// Copy a tar archive, leaving out the named entries.
+func dropTarEntries(t *testing.T, archive []byte, drop ...string) []byte {
+	var buf bytes.Buffer
+	tr := tar.NewReader(bytes.NewReader(archive))
+	tw := tar.NewWriter(&buf)
+entries:
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range drop {
+			if hdr.Name == d {
+				continue entries
+			}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTarRoundTrip(t *testing.T) {
+	data := []byte("an object that does not fill its shards")
+	const k = 3
+	n := (len(data) + k - 1) / k
+	in := makeMatrix(k, n)
+	for i := range in {
+		copy(in[i], data[i*n:])
+	}
+	all_x := []byte{0, 1, 2, 3, 4}
+	shards := NewErasureCoder([]byte{0, 1, 2}, all_x).Code(in)
+
+	var buf bytes.Buffer
+	if err := ShardsToTar(&buf, all_x, shards, len(data)); err != nil {
+		t.Fatal(err)
+	}
+	damaged := dropTarEntries(t, buf.Bytes(), ShardName(0), ShardName(2))
+
+	in_x, got, orig_len, err := TarToShards(bytes.NewReader(damaged))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orig_len != len(data) {
+		t.Error("orig_len ", orig_len, " != ", len(data))
+	}
+	if !bytes.Equal(in_x, []byte{1, 3, 4}) {
+		t.Fatal("surviving abscissae ", in_x)
+	}
+
+	out := NewErasureCoder(in_x, []byte{0, 1, 2}).Code(got)
+	var restored []byte
+	for _, row := range out {
+		restored = append(restored, row...)
+	}
+	if !bytes.Equal(restored[:orig_len], data) {
+		t.Errorf("restored %q", restored[:orig_len])
+	}
+
+	// Without metadata the shards are still there.
+	in_x, _, orig_len, err = TarToShards(bytes.NewReader(dropTarEntries(t, damaged, tarMetaName)))
+	if err != nil || orig_len != -1 || len(in_x) != 3 {
+		t.Error("without metadata: ", in_x, orig_len, err)
+	}
+}
+
+// The object stored in testdata/archive-v*.tar, as 3 data and 2 parity shards.
+var backCompatData = []byte("Stored erasure coded data must remain readable for years.")
+
+func backCompatArchive(version int) string {
+	return filepath.Join("testdata", fmt.Sprintf("archive-v%d.tar", version))
+}
+
+func TestArchiveBackCompat(t *testing.T) {
+	if *update {
+		const k = 3
+		n := (len(backCompatData) + k - 1) / k
+		in := makeMatrix(k, n)
+		for i := range in {
+			copy(in[i], backCompatData[i*n:])
+		}
+		all_x := []byte{0, 1, 2, 3, 4}
+		var buf bytes.Buffer
+		if err := ShardsToTar(&buf, all_x, NewErasureCoder([]byte{0, 1, 2}, all_x).Code(in), len(backCompatData)); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(backCompatArchive(tarVersion), buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, v := range SupportedFormats() {
+		b, err := os.ReadFile(backCompatArchive(v))
+		if err != nil {
+			t.Errorf("version %d: %v", v, err)
+			continue
+		}
+		// Decode from the parity and one data shard only.
+		b = dropTarEntries(t, b, ShardName(0), ShardName(2))
+		in_x, shards, orig_len, err := TarToShards(bytes.NewReader(b))
+		if err != nil {
+			t.Errorf("version %d: %v", v, err)
+			continue
+		}
+		var restored []byte
+		for _, row := range NewErasureCoder(in_x, []byte{0, 1, 2}).Code(shards) {
+			restored = append(restored, row...)
+		}
+		if orig_len != len(backCompatData) || !bytes.Equal(restored[:orig_len], backCompatData) {
+			t.Errorf("version %d: restored %q", v, restored)
+		}
+	}
+}
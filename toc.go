@@ -0,0 +1,124 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// A TOC, or table of contents, records how a set of shards was coded,
+// so that they can be decoded without keeping track of the abscissae by
+// hand, and so that the zero padding added to the shorter inputs can be
+// cut off again.  Encoded it is
+//
+//	"RSTC"      4 bytes magic
+//	degree      2 bytes, big endian
+//	outputs     2 bytes, big endian
+//	block size  4 bytes, big endian
+//	in_x        degree bytes
+//	out_x       outputs bytes
+//	lengths     degree times 8 bytes, big endian
+type TOC struct {
+	InX       []uint8 // abscissae of the original inputs
+	OutX      []uint8 // abscissae of the coded outputs
+	BlockSize int     // block size used for coding, 0 if unknown
+	Lengths   []int64 // original length of the input at InX[i]
+}
+
+const tocHeaderLen = 12
+
+var tocMagic = []byte("RSTC")
+
+// Degree returns the number of inputs, the degree of the polynomial.
+func (t *TOC) Degree() int { return len(t.InX) }
+
+// Length returns the original length of the input at abscissa x, and
+// whether x is one of the inputs.
+func (t *TOC) Length(x uint8) (int64, bool) {
+	for i, v := range t.InX {
+		if v == x {
+			return t.Lengths[i], true
+		}
+	}
+	return 0, false
+}
+
+func (t *TOC) check() error {
+	if len(t.InX) == 0 || len(t.InX) > 256 || len(t.OutX) > 256 {
+		return fmt.Errorf("Invalid TOC with %d inputs and %d outputs", len(t.InX), len(t.OutX))
+	}
+	if len(t.Lengths) != len(t.InX) {
+		return fmt.Errorf("TOC has %d lengths for %d inputs", len(t.Lengths), len(t.InX))
+	}
+	if t.BlockSize < 0 || int64(t.BlockSize) > 1<<32-1 {
+		return fmt.Errorf("Invalid TOC block size %d", t.BlockSize)
+	}
+	for i, l := range t.Lengths {
+		if l < 0 {
+			return fmt.Errorf("Invalid TOC length %d for input %d", l, t.InX[i])
+		}
+	}
+	return nil
+}
+
+// WriteTo writes the encoded TOC to w.
+func (t *TOC) WriteTo(w io.Writer) (int64, error) {
+	if err := t.check(); err != nil {
+		return 0, err
+	}
+	b := make([]uint8, tocHeaderLen, tocHeaderLen+len(t.InX)+len(t.OutX)+8*len(t.Lengths))
+	copy(b, tocMagic)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(t.InX)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(t.OutX)))
+	binary.BigEndian.PutUint32(b[8:], uint32(t.BlockSize))
+	b = append(b, t.InX...)
+	b = append(b, t.OutX...)
+	for _, l := range t.Lengths {
+		b = binary.BigEndian.AppendUint64(b, uint64(l))
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// ReadTOC reads a TOC as written by WriteTo from r.
+func ReadTOC(r io.Reader) (*TOC, error) {
+	hdr := make([]uint8, tocHeaderLen)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("Reading TOC: %w", err)
+	}
+	if string(hdr[:4]) != string(tocMagic) {
+		return nil, fmt.Errorf("Not a TOC")
+	}
+	degree := int(binary.BigEndian.Uint16(hdr[4:]))
+	outputs := int(binary.BigEndian.Uint16(hdr[6:]))
+	t := &TOC{BlockSize: int(binary.BigEndian.Uint32(hdr[8:]))}
+
+	b := make([]uint8, degree+outputs+8*degree)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("Reading TOC: %w", err)
+	}
+	t.InX, b = b[:degree], b[degree:]
+	t.OutX, b = b[:outputs], b[outputs:]
+	t.Lengths = make([]int64, degree)
+	for i := range t.Lengths {
+		t.Lengths[i] = int64(binary.BigEndian.Uint64(b[8*i:]))
+	}
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestTOC(t *testing.T) {
+	toc := &TOC{
+		InX:       []uint8{0, 1, 2},
+		OutX:      []uint8{3, 4},
+		BlockSize: 128 << 10,
+		Lengths:   []int64{1000, 7, 1 << 40},
+	}
+	var b bytes.Buffer
+	if n, err := toc.WriteTo(&b); err != nil || n != int64(b.Len()) || n != 12+3+2+3*8 {
+		t.Fatal("WriteTo: ", n, err)
+	}
+	got, err := ReadTOC(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, toc) {
+		t.Errorf("ReadTOC: got %+v, want %+v", got, toc)
+	}
+	if got.Degree() != 3 {
+		t.Error("Degree: ", got.Degree())
+	}
+	if l, ok := got.Length(2); !ok || l != 1<<40 {
+		t.Error("Length(2): ", l, ok)
+	}
+	if _, ok := got.Length(3); ok {
+		t.Error("Length(3) found a parity shard")
+	}
+}
+
+func TestTOCInvalid(t *testing.T) {
+	var b bytes.Buffer
+	if _, err := (&TOC{InX: []uint8{0, 1}, Lengths: []int64{1}}).WriteTo(&b); err == nil {
+		t.Error("WriteTo accepted a TOC with a missing length")
+	}
+
+	toc := &TOC{InX: []uint8{0}, OutX: []uint8{1}, Lengths: []int64{5}}
+	toc.WriteTo(&b)
+	enc := b.Bytes()
+	if _, err := ReadTOC(bytes.NewReader(enc[:len(enc)-1])); err == nil {
+		t.Error("ReadTOC accepted a truncated TOC")
+	}
+	enc[0] = 'X'
+	if _, err := ReadTOC(bytes.NewReader(enc)); err == nil {
+		t.Error("ReadTOC accepted a bad magic")
+	}
+	if _, err := ReadTOC(bytes.NewReader(nil)); err == nil || !errors.Is(err, io.EOF) {
+		t.Error("ReadTOC on empty input: ", err)
+	}
+}
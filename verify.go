@@ -0,0 +1,146 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Call f with every n-element subset of 0...m-1, in lexicographic
+// order, until it returns false.  The slice passed to f is reused.
+// Returns whether all subsets were visited.
+func forSubsets(m, n int, f func([]int) bool) bool {
+	s := make([]int, 0, n)
+	var rec func(start int) bool
+	rec = func(start int) bool {
+		if len(s) == n {
+			return f(s)
+		}
+		for i := start; i <= m-(n-len(s)); i++ {
+			s = append(s, i)
+			if !rec(i + 1) {
+				return false
+			}
+			s = s[:len(s)-1]
+		}
+		return true
+	}
+	return rec(0)
+}
+
+// Verify tries at most this many hypotheses before giving up.  As they
+// are tried in order of the number of shards they take to be corrupt,
+// what the limit cuts off is the least likely ones: with 32 shards, it
+// still tries every hypothesis of up to 2 corrupt shards.
+const maxVerifySubsets = 1 << 12
+
+// Verify checks shards[], the values of a polynomial of degree
+// p.Degree() at abscissae[], for consistency, and returns the indices
+// of the shards that were silently corrupted.  It needs more than
+// Degree() shards.
+//
+// It tries the hypotheses that no shard, any one shard, any two shards
+// and so on are corrupt: for each it interpolates from Degree() of the
+// other shards, and stops at the first polynomial that more than
+// (len(shards)+Degree()-1)/2 shards agree with, as no other polynomial
+// can beat it.  That is found if the corrupt shards are at most half
+// the number of shards in excess of Degree(); if there are more, or
+// too many hypotheses to try, it returns an error.  Only the degree
+// and the field of p are used, not its abscissae.
+func (p *ErasureCoder) Verify(shards [][]uint8, abscissae []uint8) (bad []int, err error) {
+	n, k := len(shards), p.Degree()
+	if len(abscissae) != n {
+		return nil, fmt.Errorf("Wrong number of shards: %d for %d abscissae", n, len(abscissae))
+	}
+	if n <= k {
+		return nil, fmt.Errorf("Need more than %d shards to verify, have %d", k, n)
+	}
+	if err := abscissaeError("abscissae", abscissae); err != nil {
+		return nil, err
+	}
+	for i := range shards {
+		if len(shards[i]) != len(shards[0]) {
+			return nil, fmt.Errorf("Ragged shards: shard %d has length %d, shard 0 has %d", i, len(shards[i]), len(shards[0]))
+		}
+	}
+
+	found, tried := false, 0
+	suspect := make([]bool, n)
+	agree := make([]bool, n)
+	// Two distinct polynomials of degree k agree on at most k-1
+	// points, so one that agrees with more than (n+k-1)/2 shards beats
+	// any other; that takes at most (n-k)/2 corrupt shards.
+	for e := 0; 2*e <= n-k && !found; e++ {
+		complete := forSubsets(n, e, func(s []int) bool {
+			tried++
+			if tried > maxVerifySubsets {
+				return false
+			}
+
+			for i := range suspect {
+				suspect[i] = false
+			}
+			for _, i := range s {
+				suspect[i] = true
+			}
+			in_x := make([]uint8, 0, k)
+			in := make([][]uint8, 0, k)
+			var out_x []uint8
+			var rest []int
+			for i := 0; i < n; i++ {
+				if len(in) < k && !suspect[i] {
+					in_x = append(in_x, abscissae[i])
+					in = append(in, shards[i])
+				} else {
+					out_x = append(out_x, abscissae[i])
+					rest = append(rest, i)
+				}
+			}
+
+			c := NewErasureCoderField(p.field, in_x, out_x)
+			a := k
+			for i := range agree {
+				agree[i] = true
+			}
+			for j, row := range c.Code(in) {
+				if !bytes.Equal(row, shards[rest[j]]) {
+					agree[rest[j]] = false
+				} else {
+					a++
+				}
+			}
+			if 2*a <= n+k-1 {
+				return true
+			}
+
+			found = true
+			for i, ok := range agree {
+				if !ok {
+					bad = append(bad, i)
+				}
+			}
+			return false
+		})
+		if !complete && !found {
+			return nil, fmt.Errorf("Cannot locate corrupt shards: gave up after %d subsets", maxVerifySubsets)
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("Cannot locate corrupt shards: too many disagree")
+	}
+	return bad, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2012 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestForSubsets(t *testing.T) {
+	var got [][]int
+	forSubsets(4, 2, func(s []int) bool {
+		got = append(got, append([]int(nil), s...))
+		return true
+	})
+	want := [][]int{{0, 1}, {0, 2}, {0, 3}, {1, 2}, {1, 3}, {2, 3}}
+	if !reflect.DeepEqual(got, want) {
+		t.Error(got, " != ", want)
+	}
+	n := 0
+	if forSubsets(5, 3, func([]int) bool { n++; return n < 4 }) || n != 4 {
+		t.Error("forSubsets did not stop: ", n)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	all_x := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	c := NewErasureCoder([]byte{0, 1, 2, 3}, all_x)
+	shards := c.Code(randomMatrix(4, 100, 13))
+
+	if bad, err := c.Verify(shards, all_x); bad != nil || err != nil {
+		t.Error("clean stripe: ", bad, err)
+	}
+
+	// With 4 shards of redundancy, 2 corrupt ones can be located.
+	shards[1][10] ^= 1
+	shards[6][99] ^= 0x80
+	if bad, err := c.Verify(shards, all_x); !reflect.DeepEqual(bad, []int{1, 6}) || err != nil {
+		t.Error("2 corrupt shards: ", bad, err)
+	}
+
+	// One more is detected, but can't be located.
+	shards[3][0] ^= 5
+	if bad, err := c.Verify(shards, all_x); err == nil {
+		t.Error("3 corrupt shards: ", bad)
+	}
+
+	// A single redundant shard only detects.
+	if _, err := c.Verify(shards[:5], all_x[:5]); err == nil {
+		t.Error("Verify located corruption with 1 redundant shard")
+	}
+	if _, err := c.Verify(shards[:4], all_x[:4]); err == nil {
+		t.Error("Verify accepted only Degree() shards")
+	}
+}
+
+// With corrupt shards that come first, a search over the subsets in
+// lexicographic order would try most of them before a clean one.
+func TestVerifyWide(t *testing.T) {
+	const k, n = 20, 40
+	c := NewVandermondeCoder(k, n-k)
+	all_x := make([]byte, n)
+	for i := range all_x {
+		all_x[i] = byte(i)
+	}
+	shards := c.Code(randomMatrix(k, 50, 3))
+	shards[0][7] ^= 1
+	shards[1][8] ^= 2
+	shards[38][9] ^= 3
+	if bad, err := c.Verify(shards, all_x); !reflect.DeepEqual(bad, []int{0, 1, 38}) || err != nil {
+		t.Error("3 corrupt shards of 40: ", bad, err)
+	}
+}